@@ -0,0 +1,602 @@
+package boogie
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/combinator"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/preprocess"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StatisticsCache stores values computed by a statistics source so that they do not need to be requested again.
+type StatisticsCache interface {
+	// Get decodes the value stored at key into v, reporting whether the key was present.
+	Get(key string, v interface{}) (bool, error)
+	// Set stores v at key.
+	Set(key string, v interface{}) error
+	// Invalidate removes every value from the cache.
+	Invalidate() error
+}
+
+// MapStatisticsCache is an in-memory statistics cache which lives for the duration of a run.
+type MapStatisticsCache struct {
+	values map[string][]byte
+	mu     sync.RWMutex
+}
+
+// NewMapStatisticsCache creates a new in-memory statistics cache.
+func NewMapStatisticsCache() *MapStatisticsCache {
+	return &MapStatisticsCache{values: make(map[string][]byte)}
+}
+
+func (c *MapStatisticsCache) Get(key string, v interface{}) (bool, error) {
+	c.mu.RLock()
+	b, ok := c.values[key]
+	c.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return true, gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+func (c *MapStatisticsCache) Set(key string, v interface{}) error {
+	buff := new(bytes.Buffer)
+	err := gob.NewEncoder(buff).Encode(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = buff.Bytes()
+	return nil
+}
+
+func (c *MapStatisticsCache) Invalidate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = make(map[string][]byte)
+	return nil
+}
+
+// FileStatisticsCache is a statistics cache that persists values to a directory so they can be re-used between runs.
+type FileStatisticsCache struct {
+	Path string
+}
+
+// NewFileStatisticsCache creates a new file-backed statistics cache in the specified directory.
+func NewFileStatisticsCache(dir string) (FileStatisticsCache, error) {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return FileStatisticsCache{}, err
+	}
+	return FileStatisticsCache{Path: dir}, nil
+}
+
+func (c FileStatisticsCache) file(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return path.Join(c.Path, hex.EncodeToString(h[:]))
+}
+
+func (c FileStatisticsCache) Get(key string, v interface{}) (bool, error) {
+	b, err := ioutil.ReadFile(c.file(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+func (c FileStatisticsCache) Set(key string, v interface{}) error {
+	buff := new(bytes.Buffer)
+	err := gob.NewEncoder(buff).Encode(v)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crashed run never leaves a partial value behind.
+	tmp := c.file(key) + ".tmp"
+	err = ioutil.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file(key))
+}
+
+// Invalidate removes the values stored in the directory of the cache (and the temporary files of interrupted writes).
+// Nothing else in the directory is removed, as it may not belong to the cache.
+func (c FileStatisticsCache) Invalidate() error {
+	files, err := ioutil.ReadDir(c.Path)
+	if os.IsNotExist(err) {
+		return os.MkdirAll(c.Path, 0777)
+	} else if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".tmp")
+		if b, err := hex.DecodeString(name); err != nil || len(b) != sha256.Size || !f.Mode().IsRegular() {
+			continue
+		}
+		err = os.Remove(path.Join(c.Path, f.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LayeredStatisticsCache queries several caches in order (e.g. memory before file).
+// Values found in a later cache are copied into the earlier ones.
+type LayeredStatisticsCache []StatisticsCache
+
+func (c LayeredStatisticsCache) Get(key string, v interface{}) (bool, error) {
+	for i, cache := range c {
+		ok, err := cache.Get(key, v)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			for j := 0; j < i; j++ {
+				err = c[j].Set(key, v)
+				if err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c LayeredStatisticsCache) Set(key string, v interface{}) error {
+	for _, cache := range c {
+		err := cache.Set(key, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c LayeredStatisticsCache) Invalidate() error {
+	for _, cache := range c {
+		err := cache.Invalidate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CachedStatisticsSource wraps a statistics source, caching retrieval results and per-term statistics.
+// Methods that are not cached are passed through to the underlying source.
+type CachedStatisticsSource struct {
+	stats.StatisticsSource
+	Cache StatisticsCache
+	// Prefix separates the values of differently configured statistics sources sharing a cache.
+	Prefix     string
+	retrieval  bool
+	statistics bool
+}
+
+// NewCachedStatisticsSource creates a statistics source that caches values from ss.
+func NewCachedStatisticsSource(ss stats.StatisticsSource, cache StatisticsCache, prefix string, retrieval, statistics bool) *CachedStatisticsSource {
+	return &CachedStatisticsSource{
+		StatisticsSource: ss,
+		Cache:            cache,
+		Prefix:           prefix,
+		retrieval:        retrieval,
+		statistics:       statistics,
+	}
+}
+
+func (c *CachedStatisticsSource) key(method string, args ...interface{}) string {
+	return fmt.Sprintf("%s:%s:%v", c.Prefix, method, args)
+}
+
+func (c *CachedStatisticsSource) float(enabled bool, key string, fn func() (float64, error)) (float64, error) {
+	if !enabled {
+		return fn()
+	}
+	var v float64
+	ok, err := c.Cache.Get(key, &v)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return v, nil
+	}
+	v, err = fn()
+	if err != nil {
+		return v, err
+	}
+	return v, c.Cache.Set(key, v)
+}
+
+func (c *CachedStatisticsSource) TermFrequency(term, field, document string) (float64, error) {
+	return c.float(c.statistics, c.key("tf", term, field, document), func() (float64, error) {
+		return c.StatisticsSource.TermFrequency(term, field, document)
+	})
+}
+
+func (c *CachedStatisticsSource) DocumentFrequency(term, field string) (float64, error) {
+	return c.float(c.statistics, c.key("df", term, field), func() (float64, error) {
+		return c.StatisticsSource.DocumentFrequency(term, field)
+	})
+}
+
+func (c *CachedStatisticsSource) TotalTermFrequency(term, field string) (float64, error) {
+	return c.float(c.statistics, c.key("ttf", term, field), func() (float64, error) {
+		return c.StatisticsSource.TotalTermFrequency(term, field)
+	})
+}
+
+func (c *CachedStatisticsSource) InverseDocumentFrequency(term, field string) (float64, error) {
+	return c.float(c.statistics, c.key("idf", term, field), func() (float64, error) {
+		return c.StatisticsSource.InverseDocumentFrequency(term, field)
+	})
+}
+
+func (c *CachedStatisticsSource) VocabularySize(field string) (float64, error) {
+	return c.float(c.statistics, c.key("vocab", field), func() (float64, error) {
+		return c.StatisticsSource.VocabularySize(field)
+	})
+}
+
+func (c *CachedStatisticsSource) CollectionSize() (float64, error) {
+	return c.float(c.statistics, c.key("n"), func() (float64, error) {
+		return c.StatisticsSource.CollectionSize()
+	})
+}
+
+func (c *CachedStatisticsSource) RetrievalSize(query cqr.CommonQueryRepresentation) (float64, error) {
+	return c.float(c.retrieval, c.key("size", query.String()), func() (float64, error) {
+		return c.StatisticsSource.RetrievalSize(query)
+	})
+}
+
+func (c *CachedStatisticsSource) Execute(query pipeline.Query, options stats.SearchOptions) (trecresults.ResultList, error) {
+	if !c.retrieval {
+		return c.StatisticsSource.Execute(query, options)
+	}
+	key := c.key("execute", query.Topic, query.Query.String(), options)
+	var results trecresults.ResultList
+	ok, err := c.Cache.Get(key, &results)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return results, nil
+	}
+	results, err = c.StatisticsSource.Execute(query, options)
+	if err != nil {
+		return results, err
+	}
+	return results, c.Cache.Set(key, results)
+}
+
+// unwrapStatisticsSource returns the statistics source underneath any caching or retrying layers.
+func unwrapStatisticsSource(ss stats.StatisticsSource) stats.StatisticsSource {
+	switch s := ss.(type) {
+	case *CachedStatisticsSource:
+		return unwrapStatisticsSource(s.StatisticsSource)
+	case *RetryingStatisticsSource:
+		return unwrapStatisticsSource(s.StatisticsSource)
+	}
+	return ss
+}
+
+// retrievalSource is the statistics source that groove retrieves the documents of queries with. groove only scrolls
+// through every document an Elasticsearch source retrieves (rather than the top search.size) when it is given the
+// Elasticsearch source itself, so it is used underneath any caching or retrying layers; the documents it retrieves are
+// cached by the query cache instead.
+func retrievalSource(ss stats.StatisticsSource) stats.StatisticsSource {
+	if es, ok := unwrapStatisticsSource(ss).(*stats.ElasticsearchStatisticsSource); ok {
+		return es
+	}
+	return ss
+}
+
+// sourcedMeasurement computes a measurement using a statistics source other than the one groove retrieves with, so
+// that measurements use the caching and retrying layers of the pipeline (see retrievalSource). groove caches the
+// measurements of a query by their name in the user cache directory, so the name of the measurement includes key,
+// which identifies the configuration of the statistics source (see measurementName).
+type sourcedMeasurement struct {
+	analysis.Measurement
+	source stats.StatisticsSource
+	key    string
+}
+
+// measurementKeySeparator separates the name of a measurement from the key of its statistics source.
+const measurementKeySeparator = "@"
+
+func (m sourcedMeasurement) Name() string {
+	return m.Measurement.Name() + measurementKeySeparator + m.key
+}
+
+// measurementName is the name of a measurement computed by groove, without the key of its statistics source.
+func measurementName(name string) string {
+	if i := strings.LastIndex(name, measurementKeySeparator); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+func (m sourcedMeasurement) Execute(q pipeline.Query, _ stats.StatisticsSource) (float64, error) {
+	v, err := m.Measurement.Execute(q, m.source)
+	if err != nil {
+		return v, measurementError{topic: q.Topic, err: err}
+	}
+	return v, nil
+}
+
+// unwrappedTransformation binds an Elasticsearch transformation to the Elasticsearch statistics source underneath any
+// caching or retrying layers, as groove only applies them to an unwrapped source.
+func unwrappedTransformation(t preprocess.ElasticsearchTransformation, ss stats.StatisticsSource) (preprocess.BooleanTransformation, error) {
+	s, ok := unwrapStatisticsSource(ss).(*stats.ElasticsearchStatisticsSource)
+	if !ok {
+		return nil, fmt.Errorf("elasticsearch transformations require the elasticsearch statistic source")
+	}
+	return func(q cqr.CommonQueryRepresentation, topic string) preprocess.Transformation {
+		return t(q, s)
+	}, nil
+}
+
+// NewStatisticsCache creates a cache from the `cache` section of the DSL.
+// When more than one cache is configured, they are queried in the order specified.
+func NewStatisticsCache(config []PipelineCache) (StatisticsCache, error) {
+	if len(config) == 0 {
+		return nil, nil
+	}
+	var caches LayeredStatisticsCache
+	for _, c := range config {
+		options, err := cacheOptions(c)
+		if err != nil {
+			return nil, err
+		}
+		var cache StatisticsCache
+		switch c.Type {
+		case "memory":
+			cache = NewMapStatisticsCache()
+		case "file":
+			fc, err := NewFileStatisticsCache(options.Path)
+			if err != nil {
+				return nil, err
+			}
+			cache = fc
+		}
+		if options.Invalidate {
+			err := cache.Invalidate()
+			if err != nil {
+				return nil, err
+			}
+		}
+		caches = append(caches, cache)
+	}
+	if len(caches) == 1 {
+		return caches[0], nil
+	}
+	return caches, nil
+}
+
+// cacheOptions decodes the options of a cache. The options of a memory cache are those of a file cache without a path.
+func cacheOptions(c PipelineCache) (FileCacheOptions, error) {
+	var options FileCacheOptions
+	switch c.Type {
+	case "memory":
+		err := decodeOptions("memory cache", c.Options, &options.CacheOptions)
+		if err != nil {
+			return options, err
+		}
+	case "file":
+		err := decodeOptions("file cache", c.Options, &options)
+		if err != nil {
+			return options, err
+		}
+		if len(options.Path) == 0 {
+			return options, fmt.Errorf("a path must be specified for the file cache")
+		}
+	default:
+		return options, fmt.Errorf("%v is not a known cache type", c.Type)
+	}
+	return options, nil
+}
+
+// cacheScope determines whether retrieval results and/or term statistics are cached.
+// By default, both are cached; the `scope` option of any cache restricts this.
+func cacheScope(config []PipelineCache) (retrieval, statistics bool, err error) {
+	scoped := false
+	for _, c := range config {
+		options, err := cacheOptions(c)
+		if err != nil {
+			return false, false, err
+		}
+		if options.Scope != nil {
+			scoped = true
+			for _, s := range options.Scope {
+				switch s {
+				case "retrieval":
+					retrieval = true
+				case "statistics":
+					statistics = true
+				default:
+					return false, false, fmt.Errorf("%v is not a known cache scope (expected retrieval or statistics)", s)
+				}
+			}
+		}
+	}
+	if !scoped {
+		return true, true, nil
+	}
+	return
+}
+
+// NewCachedStatisticsSourceFromDSL wraps the statistics source with the caches configured in the DSL.
+// The cache keys are prefixed with the configuration of the statistic source so that different indices do not collide.
+func NewCachedStatisticsSourceFromDSL(ss stats.StatisticsSource, config []PipelineCache, statistic interface{}) (stats.StatisticsSource, error) {
+	if len(config) == 0 {
+		return ss, nil
+	}
+	cache, err := NewStatisticsCache(config)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := cachePrefix(statistic)
+	if err != nil {
+		return nil, err
+	}
+	retrieval, statistics, err := cacheScope(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewCachedStatisticsSource(ss, cache, prefix, retrieval, statistics), nil
+}
+
+// MapQueryCache caches the documents retrieved for queries in memory, for the duration of a run. Unlike the map
+// query cache of groove, it can be used by the topics of a run concurrently.
+type MapQueryCache struct {
+	docs map[uint64]combinator.Documents
+	mu   sync.RWMutex
+}
+
+// NewMapQueryCache creates a new in-memory query cache.
+func NewMapQueryCache() *MapQueryCache {
+	return &MapQueryCache{docs: make(map[uint64]combinator.Documents)}
+}
+
+func (c *MapQueryCache) Get(query cqr.CommonQueryRepresentation) (combinator.Documents, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if docs, ok := c.docs[combinator.HashCQR(query)]; ok {
+		return docs, nil
+	}
+	return combinator.Documents{}, combinator.ErrCacheMiss
+}
+
+func (c *MapQueryCache) Set(query cqr.CommonQueryRepresentation, docs combinator.Documents) error {
+	sort.Sort(docs)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs[combinator.HashCQR(query)] = docs
+	return nil
+}
+
+// cachePrefix identifies the configuration of a statistic source in the keys and directories of caches, so that
+// different indices do not collide.
+func cachePrefix(statistic interface{}) (string, error) {
+	b, err := json.Marshal(statistic)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:8]), nil
+}
+
+// NewQueryCacher creates the query cache of the documents that the statistic source configured by statistic
+// retrieves for queries, which groove and query chain candidate selectors use. If a file cache in the DSL caches
+// retrieval, the documents are cached in a directory of that statistic source, which is emptied first if the cache
+// is invalidated. Otherwise, documents are only cached in memory for the duration of the run.
+func NewQueryCacher(config []PipelineCache, statistic interface{}) (combinator.QueryCacher, error) {
+	retrieval, _, err := cacheScope(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range config {
+		if c.Type != "file" || !retrieval {
+			continue
+		}
+		options, err := cacheOptions(c)
+		if err != nil {
+			return nil, err
+		}
+		prefix, err := cachePrefix(statistic)
+		if err != nil {
+			return nil, err
+		}
+		dir := path.Join(options.Path, "combinator", prefix)
+		if options.Invalidate {
+			err = invalidateQueryCache(dir)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = os.MkdirAll(dir, 0777)
+		if err != nil {
+			return nil, err
+		}
+		return combinator.NewFileQueryCache(dir), nil
+	}
+	return NewMapQueryCache(), nil
+}
+
+// invalidateQueryCache removes the documents that file query caches have cached in dir, which are named by the hash of
+// their query. Nothing else in dir is removed.
+func invalidateQueryCache(dir string) error {
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, err := strconv.ParseUint(info.Name(), 10, 64); err == nil && info.Mode().IsRegular() {
+			return os.Remove(p)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// invalidateMeasurementCache removes the measurements that groove has cached in the user cache directory. groove
+// caches measurements by query and measurement only, regardless of the statistic source.
+func invalidateMeasurementCache() error {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path.Join(dir, "groove", "statistics_cache"))
+}
+
+// InvalidateCache removes every value from the caches configured in the DSL, the documents cached for queries, and the
+// measurements cached by groove.
+func InvalidateCache(dsl Pipeline) error {
+	cache, err := NewStatisticsCache(dsl.Cache)
+	if err != nil {
+		return err
+	}
+	if cache != nil {
+		err = cache.Invalidate()
+		if err != nil {
+			return err
+		}
+	}
+	for _, c := range dsl.Cache {
+		if c.Type != "file" {
+			continue
+		}
+		options, err := cacheOptions(c)
+		if err != nil {
+			return err
+		}
+		err = invalidateQueryCache(path.Join(options.Path, "combinator"))
+		if err != nil {
+			return err
+		}
+	}
+	return invalidateMeasurementCache()
+}
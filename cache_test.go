@@ -0,0 +1,124 @@
+package boogie
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/combinator"
+	"github.com/hscells/groove/stats"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRetrievalSource(t *testing.T) {
+	es := &stats.ElasticsearchStatisticsSource{}
+	local := newTestLocalSource(t, "boolean", testMEDLINECollection)
+	cached := &CachedStatisticsSource{StatisticsSource: local, Cache: NewMapStatisticsCache()}
+	tests := []struct {
+		name string
+		ss   stats.StatisticsSource
+		want stats.StatisticsSource
+	}{
+		{"elasticsearch", es, es},
+		{"cached elasticsearch", &CachedStatisticsSource{StatisticsSource: es, Cache: NewMapStatisticsCache()}, es},
+		{"retried elasticsearch", NewRetryingStatisticsSource(es, 1), es},
+		{"cached local", cached, cached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retrievalSource(tt.ss); got != tt.want {
+				t.Errorf("retrievalSource() = %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewQueryCacher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boogie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := func(invalidate bool) []PipelineCache {
+		return []PipelineCache{{Type: "file", Options: map[string]interface{}{"path": dir, "invalidate": invalidate}}}
+	}
+	a := PipelineStatistic{Source: "local", Options: map[string]interface{}{"index": "a"}}
+	b := PipelineStatistic{Source: "local", Options: map[string]interface{}{"index": "b"}}
+	q := cqr.NewKeyword("heart", "text")
+
+	qa, err := NewQueryCacher(config(false), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = qa.Set(q, combinator.Documents{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files in the cache directory that were not cached for a query are never removed.
+	notes := filepath.Join(dir, "combinator", "notes.txt")
+	err = ioutil.WriteFile(notes, []byte("notes"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qa, err = NewQueryCacher(config(false), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := qa.Get(q); err != nil || !reflect.DeepEqual(got, combinator.Documents{1, 2}) {
+		t.Errorf("Get() of source a = %v, %v, want [1 2]", got, err)
+	}
+	qb, err := NewQueryCacher(config(false), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qb.Get(q); err != combinator.ErrCacheMiss {
+		t.Errorf("Get() of source b = %v, want a cache miss", err)
+	}
+
+	qa, err = NewQueryCacher(config(true), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qa.Get(q); err != combinator.ErrCacheMiss {
+		t.Errorf("Get() of invalidated source a = %v, want a cache miss", err)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("invalidating the cache removed other files: %v", err)
+	}
+}
+
+func TestFileStatisticsCacheInvalidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boogie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewFileStatisticsCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Set("key", 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The cache may be pointed at a directory that holds other files.
+	notes := filepath.Join(dir, "notes.txt")
+	err = ioutil.WriteFile(notes, []byte("notes"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Invalidate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v float64
+	if ok, err := c.Get("key", &v); ok || err != nil {
+		t.Errorf("Get() after Invalidate() = %v, %v, want a miss", ok, err)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("Invalidate() removed other files: %v", err)
+	}
+}
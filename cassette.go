@@ -0,0 +1,376 @@
+package boogie
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Modes of a cassette.
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// redactedKeys are the query and form parameters whose values are not recorded, as they are secrets.
+var redactedKeys = map[string]bool{"api_key": true, "apikey": true, "password": true, "secret": true}
+
+// cassetteRequest is a request to a remote service, with any secrets redacted.
+type cassetteRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// cassetteResponse is the response of a remote service to a request.
+type cassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+	// Base64 is whether the body is base64 encoded, as it is not text.
+	Base64 bool `json:"base64,omitempty"`
+}
+
+// cassetteInteraction is a request and the response to it, as it is written to a cassette.
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+// Cassette records the requests made to remote services (e.g. Elasticsearch, Entrez, MetaMap, UMLS, and headway) and
+// their responses to a directory, or replays them from it without access to the network. Requests are matched by
+// their method, URL, and body, and identical requests are replayed in the order they were recorded.
+type Cassette struct {
+	Path string
+	Mode string
+	// loose are the hosts whose requests are matched without their body, as it changes between runs (i.e. the
+	// progress reported to headway).
+	loose map[string]bool
+	// seen counts the requests made with each key, and recorded is the last recorded request of a key when it is
+	// replayed more times than it was recorded.
+	seen      map[string]int
+	recorded  map[string]int
+	unmatched []string
+	mu        sync.Mutex
+}
+
+var (
+	activeCassette *Cassette
+	cassetteMu     sync.RWMutex
+)
+
+// currentCassette is the cassette in use, if any.
+func currentCassette() *Cassette {
+	cassetteMu.RLock()
+	defer cassetteMu.RUnlock()
+	return activeCassette
+}
+
+// replaying reports whether requests are replayed from a cassette rather than sent to the network.
+func replaying() bool {
+	c := currentCassette()
+	return c != nil && c.Mode == CassetteReplay
+}
+
+// UnrecordedRequestError is the error of a request that has no recorded response when replaying. It is never retried,
+// as the response of a replayed request cannot change.
+type UnrecordedRequestError struct {
+	Cassette string
+	Request  string
+}
+
+func (e UnrecordedRequestError) Error() string {
+	return fmt.Sprintf("no response was recorded in %s for %s", e.Cassette, e.Request)
+}
+
+// isUnrecorded reports whether an error is caused by a request that has no recorded response.
+func isUnrecorded(err error) bool {
+	var e UnrecordedRequestError
+	return errors.As(err, &e)
+}
+
+// cassetteTransport sends requests to the network through the cassette in use when the request is made, if any.
+type cassetteTransport struct {
+	next http.RoundTripper
+}
+
+func (t cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c := currentCassette(); c != nil {
+		return c.roundTrip(req, t.next)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// withCassette wraps a transport that sends requests to the network with the cassette in use.
+func withCassette(transport http.RoundTripper) http.RoundTripper {
+	return cassetteTransport{next: transport}
+}
+
+// cassetteProblem reports why the requests of a pipeline cannot be recorded or replayed.
+func cassetteProblem(dsl Pipeline) error {
+	switch dsl.Cassette.Mode {
+	case CassetteRecord, CassetteReplay:
+	default:
+		return fmt.Errorf("%v is not a known cassette mode (expected one of: record, replay)", dsl.Cassette.Mode)
+	}
+	if len(dsl.Cassette.Path) == 0 {
+		return fmt.Errorf("a cassette path must be supplied to %s requests", dsl.Cassette.Mode)
+	}
+	if dsl.Formulation.Options["entity_expander"] == "cui2vec_rpc" || dsl.Formulation.Options["logic_composer"] == "rake" {
+		return fmt.Errorf("requests to the cui2vec rpc (gRPC) cannot be recorded or replayed")
+	}
+	return nil
+}
+
+// UseCassette records or replays the requests made to remote services from now on, as configured by the cassette of
+// a pipeline, until the cassette is closed. Recording removes any requests previously recorded to the cassette.
+func UseCassette(dsl Pipeline) (*Cassette, error) {
+	if c := currentCassette(); c != nil {
+		return nil, fmt.Errorf("the cassette %s is already in use", c.Path)
+	}
+	err := cassetteProblem(dsl)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{
+		Path:     dsl.Cassette.Path,
+		Mode:     dsl.Cassette.Mode,
+		loose:    make(map[string]bool),
+		seen:     make(map[string]int),
+		recorded: make(map[string]int),
+	}
+	if len(dsl.Headway.Host) > 0 {
+		u, err := url.Parse(dsl.Headway.Host)
+		if err != nil {
+			return nil, err
+		}
+		c.loose[u.Host] = true
+	}
+
+	switch c.Mode {
+	case CassetteRecord:
+		err = os.MkdirAll(c.Path, 0755)
+		if err != nil {
+			return nil, err
+		}
+		files, err := filepath.Glob(filepath.Join(c.Path, "*.interaction.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			err = os.Remove(file)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case CassetteReplay:
+		if _, err := os.Stat(c.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	installTransport()
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	if activeCassette != nil {
+		return nil, fmt.Errorf("the cassette %s is already in use", activeCassette.Path)
+	}
+	activeCassette = c
+	return c, nil
+}
+
+// Close stops recording or replaying requests with the cassette, so that requests are sent to the network again.
+func (c *Cassette) Close() {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	if activeCassette == c {
+		activeCassette = nil
+	}
+}
+
+// Err reports the requests that had no recorded response when replaying.
+func (c *Cassette) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.unmatched) == 0 {
+		return nil
+	}
+	return fmt.Errorf("no response was recorded in %s for %d requests:\n%s", c.Path, len(c.unmatched), strings.Join(c.unmatched, "\n"))
+}
+
+// redactValues replaces the values of secret parameters.
+func redactValues(values url.Values) url.Values {
+	for key := range values {
+		if redactedKeys[strings.ToLower(key)] {
+			values[key] = []string{"REDACTED"}
+		}
+	}
+	return values
+}
+
+// cassetteRequestOf is the request as it is recorded to, and matched in, a cassette.
+func (c *Cassette) cassetteRequestOf(req *http.Request, body []byte) cassetteRequest {
+	u := *req.URL
+	u.User = nil
+	u.RawQuery = redactValues(u.Query()).Encode()
+	r := cassetteRequest{Method: req.Method, URL: u.String()}
+	if c.loose[req.URL.Host] {
+		return r
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			body = []byte(redactValues(values).Encode())
+		}
+	}
+	r.Body = string(body)
+	return r
+}
+
+// filename is the file of the nth request with a key.
+func (c *Cassette) filename(key string, n int) string {
+	return filepath.Join(c.Path, fmt.Sprintf("%x-%d.interaction.json", sha256.Sum256([]byte(key)), n))
+}
+
+func (c *Cassette) roundTrip(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	r := c.cassetteRequestOf(req, body)
+	key := r.Method + " " + r.URL + "\n" + r.Body
+
+	c.mu.Lock()
+	n := c.seen[key]
+	c.seen[key]++
+	c.mu.Unlock()
+
+	if c.Mode == CassetteReplay {
+		return c.replay(req, r, key, n)
+	}
+
+	if req.Body != nil {
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	i := cassetteInteraction{
+		Request: r,
+		Response: cassetteResponse{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       string(b),
+		},
+	}
+	if !utf8.Valid(b) {
+		i.Response.Body = base64.StdEncoding.EncodeToString(b)
+		i.Response.Base64 = true
+	}
+	buff := new(bytes.Buffer)
+	e := json.NewEncoder(buff)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+	err = e.Encode(i)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(c.filename(key, n), buff.Bytes(), 0644)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// replay responds to the nth request with a key. When a request is made more times than it was recorded, the last
+// response recorded is used.
+func (c *Cassette) replay(req *http.Request, r cassetteRequest, key string, n int) (*http.Response, error) {
+	c.mu.Lock()
+	if last, ok := c.recorded[key]; ok && n > last {
+		n = last
+	}
+	c.mu.Unlock()
+
+	var (
+		b   []byte
+		err error
+		m   = n
+	)
+	for ; m >= 0; m-- {
+		b, err = ioutil.ReadFile(c.filename(key, m))
+		if err == nil || !os.IsNotExist(err) {
+			break
+		}
+	}
+	if m >= 0 && m < n {
+		c.mu.Lock()
+		c.recorded[key] = m
+		c.mu.Unlock()
+	}
+	if os.IsNotExist(err) {
+		request := r.Method + " " + r.URL
+		if len(r.Body) > 0 {
+			request += " " + r.Body
+		}
+		c.mu.Lock()
+		c.unmatched = append(c.unmatched, request)
+		c.mu.Unlock()
+		log.Printf("no response was recorded in %s for %s\n", c.Path, request)
+		return nil, UnrecordedRequestError{Cassette: c.Path, Request: request}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var i cassetteInteraction
+	err = json.Unmarshal(b, &i)
+	if err != nil {
+		return nil, err
+	}
+	body := []byte(i.Response.Body)
+	if i.Response.Base64 {
+		body, err = base64.StdEncoding.DecodeString(i.Response.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &http.Response{
+		Status:        i.Response.Status,
+		StatusCode:    i.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Response.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
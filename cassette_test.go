@@ -0,0 +1,128 @@
+package boogie
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCassette(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boogie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cassette := filepath.Join(dir, "cassette")
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		r.ParseForm()
+		w.Write([]byte("hello " + r.Form.Get("name")))
+	}))
+	defer server.Close()
+	get := func() (string, error) {
+		resp, err := http.PostForm(server.URL+"/greet?api_key=secret", url.Values{"name": {"boogie"}, "password": {"hunter2"}})
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	// The cassette is used before an entrez source is configured.
+	c, err := UseCassette(Pipeline{Cassette: PipelineCassette{Path: cassette, Mode: CassetteRecord}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = configureEntrez(EntrezOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "hello boogie" {
+		t.Errorf("recorded body = %q, want %q", body, "hello boogie")
+	}
+	_, err = UseCassette(Pipeline{Cassette: PipelineCassette{Path: cassette, Mode: CassetteReplay}})
+	if err == nil {
+		t.Error("expected a second cassette to be refused while the first is in use")
+	}
+	c.Close()
+
+	files, err := filepath.Glob(filepath.Join(cassette, "*.interaction.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("recorded %d interactions, want 1", len(files))
+	}
+	b, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret", "hunter2"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("recorded interaction contains %q:\n%s", secret, b)
+		}
+	}
+
+	// The entrez source is already configured, and the cassette replays the request without the server.
+	server.Close()
+	c, err = UseCassette(Pipeline{Cassette: PipelineCassette{Path: cassette, Mode: CassetteReplay}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "hello boogie" {
+		t.Errorf("replayed body = %q, want %q", body, "hello boogie")
+	}
+	if requests != 1 {
+		t.Errorf("server received %d requests, want 1", requests)
+	}
+
+	// Replayed requests to Entrez are not rate limited.
+	err = ioutil.WriteFile(c.filename("GET https://"+entrezHost+"/entrez/eutils/einfo.fcgi\n", 0),
+		[]byte(`{"response": {"status_code": 200, "status": "200 OK", "body": "einfo"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		resp, err := http.Get("https://" + entrezHost + "/entrez/eutils/einfo.fcgi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("replaying 5 entrez requests took %v", elapsed)
+	}
+
+	_, err = http.Get(server.URL + "/unrecorded")
+	if !isUnrecorded(err) {
+		t.Errorf("expected the request to have no recorded response, got %v", err)
+	}
+	if c.Err() == nil {
+		t.Error("expected the unrecorded request to be reported")
+	}
+	c.Close()
+
+	// Once closed, requests are sent to the network again.
+	_, err = get()
+	if err == nil || isUnrecorded(err) {
+		t.Errorf("expected the request to fail on the closed server, got %v", err)
+	}
+}
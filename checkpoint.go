@@ -0,0 +1,229 @@
+package boogie
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/query"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// Stages of a pipeline that are checkpointed for each topic.
+const (
+	CheckpointMeasurement    = "measurement"
+	CheckpointEvaluation     = "evaluation"
+	CheckpointTrecResults    = "trec_results"
+	CheckpointTransformation = "transformation"
+)
+
+// Checkpoint records the results of each topic as stages of a pipeline complete, so that an interrupted run can be
+// resumed. The results of a stage are stored in a directory of the same name, with a file per topic.
+type Checkpoint struct {
+	Path string
+}
+
+// NewCheckpoint creates the checkpoint configured in the DSL. Unless the run is being resumed, any results from a
+// previous run are removed. If no checkpoint is configured, nil is returned.
+func NewCheckpoint(dsl Pipeline) (*Checkpoint, error) {
+	if len(dsl.Checkpoint.Path) == 0 {
+		if dsl.Checkpoint.Resume {
+			return nil, errors.New("a checkpoint path must be supplied to resume a run")
+		}
+		return nil, nil
+	}
+	c := &Checkpoint{Path: dsl.Checkpoint.Path}
+	for _, stage := range []string{CheckpointMeasurement, CheckpointEvaluation, CheckpointTrecResults, CheckpointTransformation} {
+		if !dsl.Checkpoint.Resume {
+			err := c.clear(stage)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err := os.MkdirAll(path.Join(c.Path, stage), 0777)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// clear removes the results of a stage (and the temporary files of interrupted saves). Nothing else in the checkpoint
+// is removed, as it may not belong to the checkpoint.
+func (c *Checkpoint) clear(stage string) error {
+	files, err := ioutil.ReadDir(path.Join(c.Path, stage))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !f.Mode().IsRegular() || !(strings.HasSuffix(f.Name(), ".json") || strings.HasSuffix(f.Name(), ".json.tmp")) {
+			continue
+		}
+		err = os.Remove(path.Join(c.Path, stage, f.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Checkpoint) file(stage, topic string) string {
+	return path.Join(c.Path, stage, url.PathEscape(topic)+".json")
+}
+
+// Save records v as the result of a stage for a topic.
+func (c *Checkpoint) Save(stage, topic string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crashed run never leaves a partial result behind.
+	tmp := c.file(stage, topic) + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file(stage, topic))
+}
+
+// Load reads the result of a stage for every topic that has completed it. The value for each topic is decoded into
+// the value returned by v.
+func (c *Checkpoint) Load(stage string, v func(topic string) interface{}) error {
+	files, err := ioutil.ReadDir(path.Join(c.Path, stage))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		topic, err := url.PathUnescape(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path.Join(c.Path, stage, f.Name()))
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(b, v(topic))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Completed reports the topics which have completed a stage.
+func (c *Checkpoint) Completed(stage string) (map[string]bool, error) {
+	completed := make(map[string]bool)
+	err := c.Load(stage, func(topic string) interface{} {
+		completed[topic] = true
+		return new(json.RawMessage)
+	})
+	return completed, err
+}
+
+// checkpointStages are the stages of the DSL which produce results for each topic.
+func checkpointStages(dsl Pipeline) []string {
+	var stages []string
+	if len(dsl.Measurements) > 0 {
+		stages = append(stages, CheckpointMeasurement)
+	}
+	if len(dsl.Evaluations) > 0 {
+		stages = append(stages, CheckpointEvaluation)
+	}
+	if len(dsl.Output.Trec.Output) > 0 {
+		stages = append(stages, CheckpointTrecResults)
+	}
+	if len(dsl.Transformations.Output) > 0 {
+		stages = append(stages, CheckpointTransformation)
+	}
+	return stages
+}
+
+// CompletedTopics reports the topics that have completed every stage of the DSL in the checkpoint.
+func CompletedTopics(dsl Pipeline) (map[string]bool, error) {
+	stages := checkpointStages(dsl)
+	completed := make(map[string]bool)
+	if len(dsl.Checkpoint.Path) == 0 || len(stages) == 0 {
+		return completed, nil
+	}
+	c := &Checkpoint{Path: dsl.Checkpoint.Path}
+	count := make(map[string]int)
+	for _, stage := range stages {
+		topics, err := c.Completed(stage)
+		if err != nil {
+			return nil, err
+		}
+		for topic := range topics {
+			count[topic]++
+		}
+	}
+	for topic, n := range count {
+		if n == len(stages) {
+			completed[topic] = true
+		}
+	}
+	return completed, nil
+}
+
+// ResumedQueriesSource is a query source which skips the topics that have already been completed.
+type ResumedQueriesSource struct {
+	query.QueriesSource
+	Completed map[string]bool
+}
+
+func (r ResumedQueriesSource) Load(directory string) ([]pipeline.Query, error) {
+	queries, err := r.QueriesSource.Load(directory)
+	if err != nil {
+		return nil, err
+	}
+	var remaining []pipeline.Query
+	for _, q := range queries {
+		if !r.Completed[q.Topic] {
+			remaining = append(remaining, q)
+		}
+	}
+	return remaining, nil
+}
+
+// Restore adds the results of previously completed topics to the results of a run.
+func (c *Checkpoint) Restore(measurements, evaluations map[string]map[string]float64, trecResults, transformations map[string][]string) error {
+	for stage, results := range map[string]map[string]map[string]float64{
+		CheckpointMeasurement: measurements,
+		CheckpointEvaluation:  evaluations,
+	} {
+		err := c.Load(stage, func(topic string) interface{} {
+			m := make(map[string]float64)
+			results[topic] = m
+			return &m
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for stage, results := range map[string]map[string][]string{
+		CheckpointTrecResults:    trecResults,
+		CheckpointTransformation: transformations,
+	} {
+		lines := make(map[string]*[]string)
+		err := c.Load(stage, func(topic string) interface{} {
+			lines[topic] = new([]string)
+			return lines[topic]
+		})
+		if err != nil {
+			return err
+		}
+		for topic, l := range lines {
+			results[topic] = *l
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package boogie
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boogie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dsl := Pipeline{
+		Checkpoint:   PipelineCheckpoint{Path: dir},
+		Measurements: []string{"term_count"},
+		Output:       PipelineOutput{Trec: TrecOutput{Output: filepath.Join(dir, "run.trec")}},
+	}
+
+	c, err := NewCheckpoint(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Topic 1 completes every stage, and topic 2/a only the measurement stage.
+	for _, save := range []struct{ stage, topic string }{
+		{CheckpointMeasurement, "1"},
+		{CheckpointTrecResults, "1"},
+		{CheckpointMeasurement, "2/a"},
+	} {
+		err = c.Save(save.stage, save.topic, map[string]float64{"term_count": 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The checkpoint may be pointed at a directory that holds other files.
+	notes := filepath.Join(dir, "notes.txt")
+	err = ioutil.WriteFile(notes, []byte("notes"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming keeps the results of the previous run.
+	dsl.Checkpoint.Resume = true
+	c, err = NewCheckpoint(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	measurements := make(map[string]map[string]float64)
+	err = c.Load(CheckpointMeasurement, func(topic string) interface{} {
+		m := make(map[string]float64)
+		measurements[topic] = m
+		return &m
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]map[string]float64{"1": {"term_count": 2}, "2/a": {"term_count": 2}}; !reflect.DeepEqual(measurements, want) {
+		t.Errorf("Load() = %v, want %v", measurements, want)
+	}
+	completed, err := CompletedTopics(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"1": true}; !reflect.DeepEqual(completed, want) {
+		t.Errorf("CompletedTopics() = %v, want %v", completed, want)
+	}
+
+	// Otherwise, the results are removed, but nothing else.
+	dsl.Checkpoint.Resume = false
+	_, err = NewCheckpoint(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed, err = CompletedTopics(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(completed) > 0 {
+		t.Errorf("CompletedTopics() = %v after a new run, want none", completed)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("NewCheckpoint() removed other files: %v", err)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	dsl, dir, cleanup := newTestPipeline(t, map[string]string{"1": "heart", "2": "attack"})
+	defer cleanup()
+	dsl.Checkpoint = PipelineCheckpoint{Path: filepath.Join(dir, "checkpoint")}
+
+	r, err := NewRun(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readTestRun(t, dsl.Output.Trec.Output)
+	if len(want) != 2 {
+		t.Fatalf("run = %v, want both topics", want)
+	}
+
+	// The completed topics are skipped when resuming, so their results come from the checkpoint, even though their
+	// query is no longer retrieved.
+	err = ioutil.WriteFile(filepath.Join(dir, "queries", "1"), []byte("winter"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsl.Checkpoint.Resume = true
+	r, err = NewRun(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestRun(t, dsl.Output.Trec.Output); !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed run = %v, want %v", got, want)
+	}
+}
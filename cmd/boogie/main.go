@@ -7,9 +7,7 @@ import (
 	"fmt"
 	"github.com/alexflint/go-arg"
 	"github.com/hscells/boogie"
-	"github.com/hscells/groove"
 	"github.com/hscells/groove/eval"
-	"github.com/hscells/groove/pipeline"
 	"io"
 	"io/ioutil"
 	"log"
@@ -17,13 +15,20 @@ import (
 )
 
 type args struct {
-	Pipeline     string   `arg:"help:Path to boogie pipeline.,required"`
-	LogFile      string   `arg:"help:File to output logs to."`
-	TemplateArgs []string `arg:"help:Additional arguments to pass to template file.,positional"`
+	Pipeline        string   `arg:"help:Path to boogie pipeline.,required"`
+	LogFile         string   `arg:"help:File to output logs to."`
+	InvalidateCache bool     `arg:"--invalidate-cache,help:Remove all cached values before running the pipeline."`
+	Validate        bool     `arg:"help:Validate the pipeline and exit."`
+	DryRun          bool     `arg:"--dry-run,help:Print the plan of the pipeline without running it."`
+	Resume          bool     `arg:"help:Resume an interrupted run from the checkpoint of the pipeline."`
+	Record          string   `arg:"help:Record the requests made to remote services to a cassette directory."`
+	Replay          string   `arg:"help:Replay the requests made to remote services from a cassette directory without network access."`
+	Set             []string `arg:"help:Named arguments to pass to template file (e.g. --set index=pubmed size=100)."`
+	TemplateArgs    []string `arg:"help:Additional arguments to pass to template file.,positional"`
 }
 
 func (args) Version() string {
-	return fmt.Sprintf("boogie 16.Jan.2019 using groove %s", groove.Version)
+	return fmt.Sprintf("boogie %s using groove %s", boogie.Version, boogie.GrooveVersion())
 }
 
 func (args) Description() string {
@@ -56,24 +61,118 @@ func main() {
 		panic(err)
 	}
 
+	// Positional and named arguments to the template.
+	ctx, err := boogie.NewTemplateContext(args.TemplateArgs, args.Set)
+	if err != nil {
+		panic(err)
+	}
+
+	// Check the dsl file for unknown keys and options of the wrong type.
+	if args.Validate {
+		err = boogie.ValidateTemplate(args.Pipeline, bytes.NewBuffer(b), ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is valid\n", args.Pipeline)
+		return
+	}
+
 	// Parse the dsl file into a struct.
-	dsl, err := boogie.Template(bytes.NewBuffer(b), args.TemplateArgs...)
+	dsl, err := boogie.TemplateFile(args.Pipeline, bytes.NewBuffer(b), ctx)
 	if err != nil {
 		panic(err)
 	}
 
+	// Skip the topics that completed before the run was interrupted.
+	if args.Resume {
+		dsl.Checkpoint.Resume = true
+	}
+
+	// Record or replay the requests made to remote services.
+	if len(args.Record) > 0 && len(args.Replay) > 0 {
+		fmt.Println("requests cannot be both recorded and replayed")
+		os.Exit(1)
+	} else if len(args.Record) > 0 {
+		dsl.Cassette = boogie.PipelineCassette{Path: args.Record, Mode: boogie.CassetteRecord}
+	} else if len(args.Replay) > 0 {
+		dsl.Cassette = boogie.PipelineCassette{Path: args.Replay, Mode: boogie.CassetteReplay}
+	}
+
+	// Print what the pipeline would do, without communicating with any services.
+	if args.DryRun {
+		err = boogie.DryRun(dsl, os.Stdout)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Remove any cached values from previous runs.
+	if args.InvalidateCache {
+		err = boogie.InvalidateCache(dsl)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Record how the outputs of the run are produced.
+	manifest, err := boogie.NewManifest(dsl, ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	// The cassette must be used before any remote services are configured.
+	var cassette *boogie.Cassette
+	if len(dsl.Cassette.Mode) > 0 {
+		cassette, err = boogie.UseCassette(dsl)
+		if err != nil {
+			panic(err)
+		}
+		defer cassette.Close()
+	}
+
+	// Run every configuration of a parameter sweep.
+	if len(dsl.Sweep.Axes) > 0 {
+		err = boogie.RunSweep(dsl)
+		if err != nil {
+			panic(err)
+		}
+		err = manifest.Write()
+		if err != nil {
+			panic(err)
+		}
+		replayed(cassette)
+		return
+	}
+
 	// Create the main pipeline.
-	g, err := boogie.CreatePipeline(dsl)
+	run, err := boogie.NewRun(dsl)
 	if err != nil {
 		panic(err)
 	}
 
 	eval.RelevanceGrade = dsl.Output.Evaluations.RelevanceGrade
-	// Execute the groove pipeline. This is done in a go routine, and the results are sent back through the channel.
-	pipelineChannel := make(chan pipeline.Result)
-	go g.Execute(pipelineChannel)
-	err = boogie.Execute(dsl, pipelineChannel)
+	// Execute the groove pipeline, and write its results.
+	err = run.Execute()
 	if err != nil {
 		panic(err)
 	}
+	err = manifest.Write()
+	if err != nil {
+		panic(err)
+	}
+	replayed(cassette)
+}
+
+// replayed exits with the requests that could not be replayed from the cassette, if any.
+func replayed(cassette *boogie.Cassette) {
+	if cassette == nil {
+		return
+	}
+	if err := cassette.Err(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
@@ -3,15 +3,22 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/alexflint/go-arg"
 	"github.com/hscells/boogie"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 type args struct {
 	Pipeline     string   `arg:"help:Path to boogie pipeline."`
+	Set          []string `arg:"help:Named arguments to pass to template file (e.g. --set index=pubmed size=100)."`
+	Provenance   bool     `arg:"help:Show which template produced each key of the pipeline."`
+	Resolved     bool     `arg:"help:Output the final pipeline after templates and any extends and include keys are resolved."`
+	From         string   `arg:"help:Format of the pipeline (json or yaml or toml) which is determined from its extension by default."`
+	To           string   `arg:"help:Format to output the resolved pipeline in (json or yaml or toml)."`
 	TemplateArgs []string `arg:"help:Additional arguments to pass to template file.,positional"`
 }
 
@@ -39,7 +46,55 @@ func main() {
 		input = bytes.NewBuffer(b)
 	}
 
-	p, err := boogie.Template(input, args.TemplateArgs...)
+	ctx, err := boogie.NewTemplateContext(args.TemplateArgs, args.Set)
+	if err != nil {
+		panic(err)
+	}
+	ctx.Format = boogie.PipelineFormat(args.Pipeline)
+	if len(args.From) > 0 {
+		err = boogie.ValidFormat(args.From)
+		if err != nil {
+			panic(err)
+		}
+		ctx.Format = args.From
+	}
+
+	// Output the path of each templated key, followed by the templates that produced it.
+	if args.Provenance {
+		provenance, err := boogie.Provenance(input, ctx)
+		if err != nil {
+			panic(err)
+		}
+		for _, p := range provenance {
+			t := make([]string, len(p.Templates))
+			for i, span := range p.Templates {
+				t[i] = span.String()
+			}
+			fmt.Printf("%s\t%s\n", p.Path, strings.Join(t, " > "))
+		}
+		return
+	}
+
+	// Output only the keys of the pipeline that were set, converting between formats.
+	if args.Resolved || len(args.To) > 0 {
+		r, err := boogie.Resolve(args.Pipeline, input, ctx)
+		if err != nil {
+			panic(err)
+		}
+		if len(args.To) > 0 {
+			r, err = boogie.ConvertPipeline(r, args.To)
+			if err != nil {
+				panic(err)
+			}
+		}
+		_, err = os.Stdout.Write(r)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	p, err := boogie.TemplateFile(args.Pipeline, input, ctx)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,263 @@
+package boogie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Keys of an object in a pipeline which refer to files that the object is merged over.
+var compositionKeys = []string{"extends", "include"}
+
+// composer resolves the `extends` and `include` keys of a pipeline.
+type composer struct {
+	ctx TemplateContext
+	// composed reports whether any files were merged.
+	composed bool
+}
+
+// compositionFiles returns the files referred to by an `extends` or `include` value, which is a path or list of paths.
+func compositionFiles(key string, v interface{}) ([]string, error) {
+	switch x := v.(type) {
+	case string:
+		return []string{x}, nil
+	case []interface{}:
+		files := make([]string, len(x))
+		for i, f := range x {
+			s, ok := f.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a path or a list of paths", key)
+			}
+			files[i] = s
+		}
+		return files, nil
+	}
+	return nil, fmt.Errorf("%s must be a path or a list of paths", key)
+}
+
+// decodeDocument decodes a JSON document, keeping numbers as they were written.
+func decodeDocument(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	err := d.Decode(&v)
+	return v, err
+}
+
+// load templates and resolves a file that is extended or included.
+func (c *composer) load(file string, stack []string) (interface{}, error) {
+	for _, f := range stack {
+		if f == file {
+			return nil, fmt.Errorf("cycle of extended or included files: %s -> %s", strings.Join(stack, " -> "), file)
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// Files can be in a different format to the file that refers to them.
+	ctx := c.ctx
+	ctx.Format = PipelineFormat(file)
+	t, err := templateStringWith(f, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	b, err := pipelineJSON([]byte(t), ctx.Format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	v, err := decodeDocument(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return c.resolve(v, file, append(append([]string{}, stack...), file))
+}
+
+// resolve merges every object containing `extends` or `include` over the files it refers to. Paths are relative to
+// the directory of the file containing them, and stack is the chain of files being resolved, to detect cycles.
+func (c *composer) resolve(v interface{}, file string, stack []string) (interface{}, error) {
+	switch x := v.(type) {
+	case []interface{}:
+		for i := range x {
+			r, err := c.resolve(x[i], file, stack)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = r
+		}
+		return x, nil
+	case map[string]interface{}:
+		var bases []interface{}
+		for _, key := range compositionKeys {
+			ref, ok := x[key]
+			if !ok {
+				continue
+			}
+			delete(x, key)
+			files, err := compositionFiles(key, ref)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				if !filepath.IsAbs(f) && len(file) > 0 {
+					f = filepath.Join(filepath.Dir(file), f)
+				}
+				f, err = filepath.Abs(f)
+				if err != nil {
+					return nil, err
+				}
+				base, err := c.load(f, stack)
+				if err != nil {
+					return nil, err
+				}
+				bases = append(bases, base)
+			}
+		}
+
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			r, err := c.resolve(x[k], file, stack)
+			if err != nil {
+				return nil, err
+			}
+			x[k] = r
+		}
+
+		if len(bases) == 0 {
+			return x, nil
+		}
+		c.composed = true
+		// Later files override earlier ones, and the object itself overrides all of them.
+		var merged interface{} = map[string]interface{}{}
+		for _, base := range bases {
+			merged = mergeDocuments(merged, base)
+		}
+		return mergeDocuments(merged, x), nil
+	}
+	return v, nil
+}
+
+// mergeDocuments deep merges override over base. Objects are merged key by key, and any other value (including lists)
+// replaces the value in base. A key ending with + (e.g. "measurements+") appends its list to the list in base, and a
+// null value removes the key from base.
+func mergeDocuments(base, override interface{}) interface{} {
+	b, ok := base.(map[string]interface{})
+	o, ok2 := override.(map[string]interface{})
+	if !ok || !ok2 {
+		return finaliseDocument(override)
+	}
+	merged := make(map[string]interface{}, len(b))
+	for k, v := range b {
+		merged[k] = v
+	}
+	keys := make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := o[k]
+		switch {
+		case strings.HasSuffix(k, "+"):
+			key := strings.TrimSuffix(k, "+")
+			existing, _ := merged[key].([]interface{})
+			if list, ok := v.([]interface{}); ok {
+				merged[key] = append(append([]interface{}{}, existing...), finaliseDocument(list).([]interface{})...)
+			} else {
+				merged[key] = mergeDocuments(merged[key], v)
+			}
+		case v == nil:
+			delete(merged, k)
+		default:
+			if existing, ok := merged[k]; ok {
+				merged[k] = mergeDocuments(existing, v)
+			} else {
+				merged[k] = finaliseDocument(v)
+			}
+		}
+	}
+	return merged
+}
+
+// finaliseDocument removes merge directives from a value that has nothing to be merged with.
+func finaliseDocument(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []interface{}:
+		for i := range x {
+			x[i] = finaliseDocument(x[i])
+		}
+		return x
+	case map[string]interface{}:
+		return mergeDocuments(map[string]interface{}{}, x)
+	}
+	return v
+}
+
+// resolvePipeline templates a pipeline and resolves any `extends` and `include` keys, returning the pipeline as JSON.
+// If a JSON pipeline does not extend or include any files, the templated pipeline is returned as-is along with the
+// lines of the template it came from, so that positions can be related to the template; otherwise the sources are nil.
+func resolvePipeline(filename string, r io.Reader, ctx TemplateContext) ([]byte, templateSources, error) {
+	if len(ctx.Format) == 0 {
+		ctx.Format = PipelineFormat(filename)
+	}
+	t, _, sources, err := expandTemplate(r, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isJSON(ctx.Format) {
+		sources = nil
+	} else if sources == nil {
+		sources = templateSources{}
+	}
+	b, err := pipelineJSON([]byte(t), ctx.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := decodeDocument(b)
+	if err != nil {
+		// Leave syntax errors to be reported by the caller.
+		return b, sources, nil
+	}
+	var stack []string
+	if len(filename) > 0 {
+		f, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		stack = append(stack, f)
+	}
+	c := &composer{ctx: ctx}
+	doc, err = c.resolve(doc, filename, stack)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.composed {
+		return b, sources, nil
+	}
+	b, err = json.MarshalIndent(doc, "", "  ")
+	return b, nil, err
+}
+
+// Resolve templates a pipeline file and resolves any `extends` and `include` keys, returning the final pipeline as
+// JSON containing only the keys that were set.
+func Resolve(filename string, r io.Reader, ctx TemplateContext) ([]byte, error) {
+	b, _, err := resolvePipeline(filename, r, ctx)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
@@ -0,0 +1,214 @@
+package boogie
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeDocuments(t *testing.T) {
+	tests := []struct {
+		name           string
+		base, override string
+		want           string
+	}{
+		{
+			name:     "keys",
+			base:     `{"a": 1, "b": 2}`,
+			override: `{"b": 3, "c": 4}`,
+			want:     `{"a": 1, "b": 3, "c": 4}`,
+		},
+		{
+			name:     "nested objects",
+			base:     `{"statistic": {"source": "elasticsearch", "options": {"index": "pubmed", "size": 10}}}`,
+			override: `{"statistic": {"options": {"size": 100}}}`,
+			want:     `{"statistic": {"source": "elasticsearch", "options": {"index": "pubmed", "size": 100}}}`,
+		},
+		{
+			name:     "lists are replaced",
+			base:     `{"measurements": ["a", "b"]}`,
+			override: `{"measurements": ["c"]}`,
+			want:     `{"measurements": ["c"]}`,
+		},
+		{
+			name:     "lists are appended",
+			base:     `{"measurements": ["a", "b"]}`,
+			override: `{"measurements+": ["c"]}`,
+			want:     `{"measurements": ["a", "b", "c"]}`,
+		},
+		{
+			name:     "append without a list",
+			base:     `{}`,
+			override: `{"measurements+": ["c"]}`,
+			want:     `{"measurements": ["c"]}`,
+		},
+		{
+			name:     "null removes",
+			base:     `{"cache": [{"type": "memory"}], "scorer": "bm25"}`,
+			override: `{"cache": null}`,
+			want:     `{"scorer": "bm25"}`,
+		},
+		{
+			name:     "object replaces a value",
+			base:     `{"statistic": "elasticsearch"}`,
+			override: `{"statistic": {"source": "entrez"}}`,
+			want:     `{"statistic": {"source": "entrez"}}`,
+		},
+		{
+			name:     "directives without a base",
+			base:     `{}`,
+			override: `{"output": {"evaluations": {"measurements+": ["x"], "qrels": null}}}`,
+			want:     `{"output": {"evaluations": {"measurements": ["x"]}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base, err := decodeDocument([]byte(test.base))
+			if err != nil {
+				t.Fatal(err)
+			}
+			override, err := decodeDocument([]byte(test.override))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := decodeDocument([]byte(test.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := mergeDocuments(base, override)
+			if !reflect.DeepEqual(got, want) {
+				g, _ := json.Marshal(got)
+				t.Errorf("got %s, want %s", g, test.want)
+			}
+		})
+	}
+}
+
+func TestResolvePipeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+		err   string
+	}{
+		{
+			name: "extends",
+			files: map[string]string{
+				"pipeline.json": `{"extends": "base.json", "query": {"path": "topics"}}`,
+				"base.json":     `{"query": {"format": "medline", "path": "base"}, "measurements": ["a"]}`,
+			},
+			want: `{"measurements": ["a"], "query": {"format": "medline", "path": "topics"}}`,
+		},
+		{
+			name: "later files override earlier ones",
+			files: map[string]string{
+				"pipeline.json": `{"extends": ["a.json", "b.json"]}`,
+				"a.json":        `{"scorer": "bm25", "on_error": "abort"}`,
+				"b.json":        `{"scorer": "tfidf"}`,
+			},
+			want: `{"on_error": "abort", "scorer": "tfidf"}`,
+		},
+		{
+			name: "include in a nested object",
+			files: map[string]string{
+				"pipeline.json":       `{"statistic": {"include": "stats/es.json", "options": {"size": 10}}}`,
+				"stats/es.json":       `{"extends": "defaults.json", "source": "elasticsearch"}`,
+				"stats/defaults.json": `{"options": {"index": "pubmed", "size": 1000}}`,
+			},
+			want: `{"statistic": {"source": "elasticsearch", "options": {"index": "pubmed", "size": 10}}}`,
+		},
+		{
+			name: "yaml",
+			files: map[string]string{
+				"pipeline.json": `{"extends": "base.yaml", "scorer": "bm25"}`,
+				"base.yaml":     "measurements:\n  - a\n",
+			},
+			want: `{"measurements": ["a"], "scorer": "bm25"}`,
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"pipeline.json": `{"extends": "a.json"}`,
+				"a.json":        `{"extends": "b.json"}`,
+				"b.json":        `{"extends": "a.json"}`,
+			},
+			err: "cycle of extended or included files",
+		},
+		{
+			name: "extends itself",
+			files: map[string]string{
+				"pipeline.json": `{"extends": "pipeline.json"}`,
+			},
+			err: "cycle of extended or included files",
+		},
+		{
+			name: "included twice",
+			files: map[string]string{
+				"pipeline.json": `{"statistic": {"include": "s.json"}, "query": {"include": "s.json"}}`,
+				"s.json":        `{"options": {}}`,
+			},
+			want: `{"query": {"options": {}}, "statistic": {"options": {}}}`,
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"pipeline.json": `{"extends": "missing.json"}`,
+			},
+			err: "missing.json",
+		},
+		{
+			name: "not a path",
+			files: map[string]string{
+				"pipeline.json": `{"extends": 1}`,
+			},
+			err: "extends must be a path or a list of paths",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "boogie")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, content := range test.files {
+				path := filepath.Join(dir, name)
+				err = os.MkdirAll(filepath.Dir(path), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = ioutil.WriteFile(path, []byte(content), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			filename := filepath.Join(dir, "pipeline.json")
+			b, _, err := resolvePipeline(filename, strings.NewReader(test.files["pipeline.json"]), TemplateContext{})
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeDocument(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := decodeDocument([]byte(test.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %s, want %s", b, test.want)
+			}
+		})
+	}
+}
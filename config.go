@@ -12,7 +12,6 @@ import (
 	"github.com/hscells/groove/output"
 	"github.com/hscells/groove/preprocess"
 	"github.com/hscells/groove/query"
-	"github.com/hscells/groove/rank"
 	"github.com/hscells/merging"
 	"github.com/hscells/trecresults"
 	"io/ioutil"
@@ -25,29 +24,149 @@ func RegisterSources(dsl Pipeline) error {
 	// Statistic sources.
 	// Configuration of other parts of the pipeline can depend on the statistics source
 	// so this needs to be set up first.
-	switch s := dsl.Statistic.Source; s {
-	case "elasticsearch":
-		ss, err := NewElasticsearchStatisticsSource(dsl.Statistic.Options)
+	if len(dsl.Statistic.Source) > 0 {
+		ss, err := NewStatisticsSource(dsl.Statistic.Source, dsl.Statistic.Options)
 		if err != nil {
 			return err
 		}
-		RegisterStatisticSource(s, ss)
-	case "terrier":
-		// TODO rework code to allow linux to use Terrier.
-		//RegisterStatisticSource(s, NewTerrierStatisticsSource(dsl.Statistic.Options))
-	case "entrez":
-		ss, err := NewEntrezStatisticsSource(dsl.Statistic.Options)
+		if ss != nil {
+			RegisterStatisticSource(dsl.Statistic.Source, ss)
+		}
+		qc, err := NewQueryCacher(dsl.Cache, dsl.Statistic)
+		if err != nil {
+			return err
+		}
+		RegisterQueryCache(dsl.Statistic.Source, qc)
+	}
+
+	// Additional statistic sources are registered under their name for rank fusion.
+	for i, config := range dsl.Statistic.Sources {
+		source, name, options, err := statisticSourceConfig(config, i)
+		if err != nil {
+			return err
+		}
+		ss, err := NewStatisticsSource(source, options)
+		if err != nil {
+			return err
+		}
+		if ss != nil {
+			RegisterStatisticSource(name, ss)
+		}
+		qc, err := NewQueryCacher(dsl.Cache, config)
 		if err != nil {
 			return err
 		}
-		RegisterStatisticSource(s, ss)
+		RegisterQueryCache(name, qc)
+	}
+
+	// Components that do not communicate with other services.
+	err := RegisterComponents(dsl)
+	if err != nil {
+		return err
+	}
+
+	// Query Rewrite transformations which require additional files.
+	err = RegisterCui2VecTransformation(dsl)
+	if err != nil {
+		return err
+	}
+
+	// Machine learning models.
+	switch m := dsl.Learning.Model; m {
+	// For the case of query chains, we need to also configure the candidate selector.
+	case "query_chain":
+		var model *learning.QueryChain
+		var (
+			depth int
+			err   error
+		)
+		depth = 5
+		if v, ok := dsl.Learning.Options["depth"]; ok {
+			depth, err = strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+		}
+		switch cs := dsl.Learning.Options["candidate_selector"]; cs {
+		case "ltr_quickrank":
+			if dsl.Learning.Train != nil {
+				model = learning.NewQuickRankQueryChain(dsl.Learning.Options["binary"], dsl.Learning.Train, learning.QuickRankCandidateSelectorMaxDepth(depth))
+			} else {
+				model = learning.NewQuickRankQueryChain(dsl.Learning.Options["binary"], dsl.Learning.Test, learning.QuickRankCandidateSelectorMaxDepth(depth), learning.QuickRankCandidateSelectorStatisticsSource(statisticSourceMapping[dsl.Statistic.Source]))
+			}
+		case "reinforcement":
+			model = learning.NewReinforcementQueryChain()
+		case "nearest":
+			if dsl.Learning.Train != nil {
+				modelName := dsl.Learning.Options["model_name"]
+				model = learning.NewNearestNeighbourQueryChain(learning.NearestNeighbourModelName(modelName), learning.NearestNeighbourDepth(depth))
+			} else {
+				modelName := dsl.Learning.Options["model_name"]
+				model = learning.NewNearestNeighbourQueryChain(learning.NearestNeighbourLoadModel(modelName), learning.NearestNeighbourDepth(depth), learning.NearestNeighbourStatisticsSource(statisticSourceMapping[dsl.Statistic.Source]))
+			}
+		case "oracle":
+			b, err := ioutil.ReadFile(dsl.Output.Evaluations.Qrels)
+			if err != nil {
+				return err
+			}
+			qrels, err := trecresults.QrelsFromReader(bytes.NewReader(b))
+			if err != nil {
+				return err
+			}
+			model = learning.NewRankOracleCandidateSelector(statisticSourceMapping[dsl.Statistic.Source], qrels, evaluationMapping[dsl.Learning.Options["measurement"]], depth)
+		}
+		if v, ok := dsl.Learning.Options["transformed_output"]; ok {
+			model.TransformedOutput = v
+		}
+
+		if v, ok := dsl.Learning.Options["features"]; ok {
+			fmt.Println("loading features")
+			f, err := os.Open(v)
+			if err != nil {
+				return err
+			}
+			model.LearntFeatures, err = learning.LoadFeatures(f)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("loaded %d features\n", len(model.LearntFeatures))
+		}
+
+		RegisterModel(m, model)
+
+	default:
+		if len(dsl.Learning.Model) > 0 {
+			return errors.New(fmt.Sprintf("could not load model of type %s", m))
+		}
 	}
 
-	// Query sources.
-	RegisterQuerySource("medline", NewTransmuteQuerySource(query.MedlineTransmutePipeline, dsl.Query.Options))
-	RegisterQuerySource("pubmed", NewTransmuteQuerySource(query.PubMedTransmutePipeline, dsl.Query.Options))
-	RegisterQuerySource("cqr", NewTransmuteQuerySource(query.CQRTransmutePipeline, dsl.Query.Options))
-	RegisterQuerySource("keyword", NewKeywordQuerySource(dsl.Query.Options))
+	return nil
+}
+
+// RegisterComponents registers the components of a pipeline that can be created without communicating with other
+// services (i.e. everything except statistic sources, cui2vec, and learning models).
+func RegisterComponents(dsl Pipeline) error {
+	// Query sources. Only the options of the configured query source are decoded.
+	var (
+		transmuteOptions TransmuteQueryOptions
+		keywordOptions   KeywordQueryOptions
+	)
+	switch dsl.Query.Format {
+	case "medline", "pubmed", "cqr":
+		err := decodeOptions(dsl.Query.Format+" query source", dsl.Query.Options, &transmuteOptions)
+		if err != nil {
+			return err
+		}
+	case "keyword":
+		err := decodeOptions("keyword query source", dsl.Query.Options, &keywordOptions)
+		if err != nil {
+			return err
+		}
+	}
+	RegisterQuerySource("medline", NewTransmuteQuerySource(query.MedlineTransmutePipeline, transmuteOptions))
+	RegisterQuerySource("pubmed", NewTransmuteQuerySource(query.PubMedTransmutePipeline, transmuteOptions))
+	RegisterQuerySource("cqr", NewTransmuteQuerySource(query.CQRTransmutePipeline, transmuteOptions))
+	RegisterQuerySource("keyword", NewKeywordQuerySource(keywordOptions))
 	RegisterQuerySource("protocol", query.NewProtocolQuerySource())
 	RegisterQuerySource("tar", query.TARTask2QueriesSource{})
 
@@ -130,7 +249,14 @@ func RegisterSources(dsl Pipeline) error {
 	// Output formats.
 	RegisterMeasurementFormatter("json", output.JsonMeasurementFormatter)
 	RegisterMeasurementFormatter("csv", output.CsvMeasurementFormatter)
-	RegisterEvaluationFormatter("json", output.JsonEvaluationFormatter)
+	RegisterMeasurementFormatter("tsv", TsvMeasurementFormatter)
+	RegisterLabelledMeasurementFormatter("libsvm", LibSVMMeasurementFormatter)
+	RegisterLabelledMeasurementFormatter("ranklib", RankLibMeasurementFormatter)
+	RegisterEvaluationFormatter("json", JsonEvaluationFormatter)
+	RegisterEvaluationFormatter("csv", CsvEvaluationFormatter)
+	RegisterEvaluationFormatter("trec_eval", TrecEvalEvaluationFormatter)
+	RegisterEvaluationFormatter("latex", LatexEvaluationFormatter)
+	RegisterEvaluationFormatter("markdown", MarkdownEvaluationFormatter)
 
 	// Query Rewrite transformations.
 	RegisterRewriteTransformation("logical_operator_replacement", learning.NewLogicalOperatorTransformer())
@@ -140,86 +266,19 @@ func RegisterSources(dsl Pipeline) error {
 	RegisterRewriteTransformation("field_restrictions", learning.NewFieldRestrictionsTransformer())
 	RegisterRewriteTransformation("adj_replacement", learning.NewAdjacencyReplacementTransformer())
 	RegisterRewriteTransformation("clause_removal", learning.NewClauseRemovalTransformer())
-	err := RegisterCui2VecTransformation(dsl)
-	if err != nil {
-		return err
-	}
 
-	RegisterScorer("bm25", &rank.BM25Scorer{K1: 1.2, B: 0.75})
-	RegisterScorer("tfidf", &rank.TFIDFScorer{})
+	// Scorers are configured with the parameters in scorer_options.
+	for _, name := range []string{"bm25", "tfidf"} {
+		scorer, err := NewScorer(name, dsl.ScorerOptions)
+		if err != nil {
+			return err
+		}
+		RegisterScorer(name, scorer)
+	}
 
 	RegisterMerger("combSUM", merging.CombSUM{})
 	RegisterMerger("combMNZ+minmax", merging.CombMNZ{})
 	RegisterMerger("borda+softmax", merging.Borda{})
 
-	// Machine learning models.
-	switch m := dsl.Learning.Model; m {
-	// For the case of query chains, we need to also configure the candidate selector.
-	case "query_chain":
-		var model *learning.QueryChain
-		var (
-			depth int
-			err   error
-		)
-		depth = 5
-		if v, ok := dsl.Learning.Options["depth"]; ok {
-			depth, err = strconv.Atoi(v)
-			if err != nil {
-				return err
-			}
-		}
-		switch cs := dsl.Learning.Options["candidate_selector"]; cs {
-		case "ltr_quickrank":
-			if dsl.Learning.Train != nil {
-				model = learning.NewQuickRankQueryChain(dsl.Learning.Options["binary"], dsl.Learning.Train, learning.QuickRankCandidateSelectorMaxDepth(depth))
-			} else {
-				model = learning.NewQuickRankQueryChain(dsl.Learning.Options["binary"], dsl.Learning.Test, learning.QuickRankCandidateSelectorMaxDepth(depth), learning.QuickRankCandidateSelectorStatisticsSource(statisticSourceMapping[dsl.Statistic.Source]))
-			}
-		case "reinforcement":
-			model = learning.NewReinforcementQueryChain()
-		case "nearest":
-			if dsl.Learning.Train != nil {
-				modelName := dsl.Learning.Options["model_name"]
-				model = learning.NewNearestNeighbourQueryChain(learning.NearestNeighbourModelName(modelName), learning.NearestNeighbourDepth(depth))
-			} else {
-				modelName := dsl.Learning.Options["model_name"]
-				model = learning.NewNearestNeighbourQueryChain(learning.NearestNeighbourLoadModel(modelName), learning.NearestNeighbourDepth(depth), learning.NearestNeighbourStatisticsSource(statisticSourceMapping[dsl.Statistic.Source]))
-			}
-		case "oracle":
-			b, err := ioutil.ReadFile(dsl.Output.Evaluations.Qrels)
-			if err != nil {
-				return err
-			}
-			qrels, err := trecresults.QrelsFromReader(bytes.NewReader(b))
-			if err != nil {
-				return err
-			}
-			model = learning.NewRankOracleCandidateSelector(statisticSourceMapping[dsl.Statistic.Source], qrels, evaluationMapping[dsl.Learning.Options["measurement"]], depth)
-		}
-		if v, ok := dsl.Learning.Options["transformed_output"]; ok {
-			model.TransformedOutput = v
-		}
-
-		if v, ok := dsl.Learning.Options["features"]; ok {
-			fmt.Println("loading features")
-			f, err := os.Open(v)
-			if err != nil {
-				return err
-			}
-			model.LearntFeatures, err = learning.LoadFeatures(f)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("loaded %d features\n", len(model.LearntFeatures))
-		}
-
-		RegisterModel(m, model)
-
-	default:
-		if len(dsl.Learning.Model) > 0 {
-			return errors.New(fmt.Sprintf("could not load model of type %s", m))
-		}
-	}
-
 	return nil
 }
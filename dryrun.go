@@ -0,0 +1,270 @@
+package boogie
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+)
+
+var (
+	builtinStatisticSources = []string{"elasticsearch", "entrez", "local", "pubmed_baseline", "terrier"}
+	builtinCaches           = []string{"memory", "file"}
+	formulationMethods      = []string{"conceptual", "objective", "dt"}
+	learningModels          = []string{"query_chain"}
+)
+
+// registered reports whether name is a key of one of the registries (e.g. measurementMapping), or one of extra.
+func registered(mapping interface{}, name string, extra ...string) bool {
+	for _, e := range extra {
+		if e == name {
+			return true
+		}
+	}
+	return reflect.ValueOf(mapping).MapIndex(reflect.ValueOf(name)).IsValid()
+}
+
+// planner writes a human-readable plan of a pipeline, and collects any problems found along the way.
+type planner struct {
+	w        io.Writer
+	problems []string
+}
+
+func (p *planner) section(name string) {
+	fmt.Fprintf(p.w, "\n%s:\n", name)
+}
+
+func (p *planner) item(format string, args ...interface{}) {
+	fmt.Fprintf(p.w, "  - %s\n", fmt.Sprintf(format, args...))
+}
+
+// check records a problem if name is not registered.
+func (p *planner) check(kind string, mapping interface{}, name string, extra ...string) {
+	if !registered(mapping, name, extra...) {
+		p.problems = append(p.problems, fmt.Sprintf("%v is not a known %s", name, kind))
+	}
+}
+
+// DryRun writes a plan of the groove pipeline that CreatePipeline would build to w, without communicating with any
+// services (e.g. Elasticsearch or Entrez). Every component in the pipeline is looked up in the registries, and an
+// error listing all of the unknown components is returned.
+func DryRun(dsl Pipeline, w io.Writer) error {
+	err := RegisterComponents(dsl)
+	if err != nil {
+		return err
+	}
+
+	p := &planner{w: w}
+	fmt.Fprintln(w, "boogie pipeline plan")
+
+	if len(dsl.Query.Path) > 0 {
+		p.section("query")
+		p.check("query source", querySourceMapping, dsl.Query.Format)
+		p.item("%s queries from %s", dsl.Query.Format, dsl.Query.Path)
+	}
+
+	if len(dsl.Statistic.Source) > 0 || len(dsl.Statistic.Sources) > 0 {
+		p.section("statistic")
+		if len(dsl.Statistic.Sources) > 0 {
+			p.check("merger", mergers, dsl.Statistic.Merger)
+			p.item("fusion of %d sources using %s", len(dsl.Statistic.Sources), dsl.Statistic.Merger)
+			for i, config := range dsl.Statistic.Sources {
+				source, name, _, err := statisticSourceConfig(config, i)
+				if err != nil {
+					p.problems = append(p.problems, err.Error())
+					continue
+				}
+				p.check("statistics source", statisticSourceMapping, source, builtinStatisticSources...)
+				if output, ok := config["output"].(string); ok {
+					p.item("%s (%s), run written to %s", name, source, output)
+				} else {
+					p.item("%s (%s)", name, source)
+				}
+			}
+		} else {
+			p.check("statistics source", statisticSourceMapping, dsl.Statistic.Source, builtinStatisticSources...)
+			p.item("%s", dsl.Statistic.Source)
+		}
+		if len(dsl.Scorer) > 0 {
+			p.check("scorer", scorers, dsl.Scorer)
+			p.item("re-ranked using %s", dsl.Scorer)
+		}
+	} else if len(dsl.Measurements) > 0 {
+		p.problems = append(p.problems, "a statistic source is required for measurements")
+	}
+
+	if len(dsl.Cache) > 0 {
+		p.section("cache")
+		for _, c := range dsl.Cache {
+			p.check("cache type", map[string]bool{}, c.Type, builtinCaches...)
+			if dir, ok := c.Options["path"].(string); ok {
+				p.item("%s (%s)", c.Type, dir)
+			} else {
+				p.item("%s", c.Type)
+			}
+		}
+	}
+
+	if len(dsl.Preprocess) > 0 {
+		p.section("preprocess")
+		for _, name := range dsl.Preprocess {
+			p.check("preprocessor", preprocessorMapping, name)
+			p.item("%s", name)
+		}
+	}
+
+	if len(dsl.Transformations.Operations) > 0 {
+		p.section("transformations (in order)")
+		for _, name := range dsl.Transformations.Operations {
+			if registered(transformationMappingBoolean, name) {
+				p.item("%s (Boolean)", name)
+			} else if registered(transformationMappingElasticsearch, name) {
+				p.item("%s (Elasticsearch)", name)
+			} else {
+				p.check("preprocessing transformation", transformationMappingBoolean, name)
+			}
+		}
+	}
+
+	if len(dsl.Measurements) > 0 {
+		p.section("measurements")
+		for _, name := range dsl.Measurements {
+			p.check("measurement", measurementMapping, name)
+			p.item("%s", name)
+		}
+	}
+
+	if len(dsl.Evaluations) > 0 {
+		p.section("evaluation")
+		for _, name := range dsl.Evaluations {
+			p.check("evaluation measurement", evaluationMapping, name)
+			p.item("%s", name)
+		}
+	}
+
+	if len(dsl.Rewrite) > 0 {
+		p.section("rewrite")
+		for _, name := range dsl.Rewrite {
+			// The cui2vec expansion is only registered once its embeddings have been loaded.
+			if name == "cui2vec_expansion" && (len(dsl.Utilities.CUI2vec) == 0 || len(dsl.Utilities.CUIMapping) == 0 || len(dsl.Utilities.QuickUMLSCache) == 0) {
+				p.problems = append(p.problems, "cui2vec_expansion requires the cui2vec, cui_mapping, and quickumls_cache utilities")
+			} else {
+				p.check("rewrite transformation", rewriteTransformationMapping, name, "cui2vec_expansion")
+			}
+			p.item("%s", name)
+		}
+	}
+
+	if len(dsl.Learning.Model) > 0 {
+		p.section("learning")
+		p.check("learning model", modelMapping, dsl.Learning.Model, learningModels...)
+		var operations []string
+		if dsl.Learning.Train != nil {
+			operations = append(operations, "train")
+		}
+		if dsl.Learning.Test != nil {
+			operations = append(operations, "test")
+		}
+		if dsl.Learning.Generate != nil {
+			operations = append(operations, "generate")
+		}
+		p.item("%s (%s)", dsl.Learning.Model, strings.Join(operations, ", "))
+	}
+
+	if len(dsl.Formulation.Method) > 0 {
+		p.section("formulation")
+		p.check("query formulation method", map[string]bool{}, dsl.Formulation.Method, formulationMethods...)
+		p.item("%s, queries written to %s/", dsl.Formulation.Method, dsl.Formulation.Method)
+	}
+
+	p.section("output")
+	if len(dsl.Output.Measurements) > 0 && len(dsl.Measurements) == 0 {
+		p.problems = append(p.problems, "at least one analysis measurement must be supplied for the output formats")
+	}
+	for _, formatter := range dsl.Output.Measurements {
+		if !registered(labelledMeasurementFormatters, formatter.Format) {
+			p.check("measurement output format", measurementFormatters, formatter.Format)
+		} else if len(formatter.Label) == 0 {
+			p.problems = append(p.problems, fmt.Sprintf("a label must be specified for the %v measurement output format", formatter.Format))
+		}
+		p.item("measurements (%s) to %s", formatter.Format, formatter.Filename)
+	}
+	if len(dsl.Output.Evaluations.Measurements) > 0 && len(dsl.Evaluations) == 0 {
+		p.problems = append(p.problems, "at least one evaluation measurement must be supplied for the output formats")
+	}
+	for _, formatter := range dsl.Output.Evaluations.Measurements {
+		p.check("evaluation output format", evaluationFormatters, formatter.Format)
+		p.item("evaluations (%s) to %s", formatter.Format, formatter.Filename)
+	}
+	if len(dsl.Output.Evaluations.Qrels) > 0 {
+		p.item("evaluated using %s (relevance grade %d)", dsl.Output.Evaluations.Qrels, dsl.Output.Evaluations.RelevanceGrade)
+	}
+	if len(dsl.Output.Evaluations.Baseline) > 0 {
+		if len(dsl.Output.Evaluations.Significance) == 0 {
+			p.problems = append(p.problems, "a significance file must be supplied when comparing evaluations to a baseline")
+		}
+		p.item("significance against %s to %s", dsl.Output.Evaluations.Baseline, dsl.Output.Evaluations.Significance)
+	}
+	if len(dsl.Output.Trec.Output) > 0 {
+		p.item("trec results to %s", dsl.Output.Trec.Output)
+	}
+	if len(dsl.Transformations.Output) > 0 {
+		p.item("transformed queries to %s/", dsl.Transformations.Output)
+	}
+	if len(dsl.Output.Errors) > 0 {
+		p.item("error report to %s", dsl.Output.Errors)
+	}
+	p.item("manifest to %s", ManifestFilename(dsl))
+	if len(dsl.Checkpoint.Path) > 0 {
+		if dsl.Checkpoint.Resume {
+			p.item("resumed from checkpoint %s/", dsl.Checkpoint.Path)
+		} else {
+			p.item("checkpoint to %s/", dsl.Checkpoint.Path)
+		}
+	} else if dsl.Checkpoint.Resume {
+		p.problems = append(p.problems, "a checkpoint path must be supplied to resume a run")
+	}
+
+	if len(dsl.Cassette.Path) > 0 || len(dsl.Cassette.Mode) > 0 {
+		if err := cassetteProblem(dsl); err != nil {
+			p.problems = append(p.problems, err.Error())
+		} else if dsl.Cassette.Mode == CassetteRecord {
+			p.item("requests recorded to cassette %s/", dsl.Cassette.Path)
+		} else {
+			p.item("requests replayed from cassette %s/", dsl.Cassette.Path)
+		}
+	}
+
+	policy, err := NewErrorPolicy(dsl.OnError)
+	if err != nil {
+		p.problems = append(p.problems, err.Error())
+	} else if !policy.Abort {
+		p.section("errors")
+		if policy.Retries > 0 {
+			p.item("failed requests retried %d times, then the topic is skipped", policy.Retries)
+		} else {
+			p.item("topics with errors are skipped")
+		}
+	}
+
+	if len(dsl.Sweep.Axes) > 0 {
+		p.section("sweep")
+		configurations, err := ExpandSweep(dsl)
+		if err != nil {
+			p.problems = append(p.problems, err.Error())
+		}
+		for _, c := range configurations {
+			p.item("%s", path.Join(dsl.Sweep.Output, c.Name))
+		}
+		if len(dsl.Sweep.Summary) > 0 {
+			p.item("summary of %d configurations to %s", len(configurations), dsl.Sweep.Summary)
+		}
+	}
+
+	if len(p.problems) > 0 {
+		return errors.New(strings.Join(p.problems, "\n"))
+	}
+	return nil
+}
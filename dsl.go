@@ -20,8 +20,13 @@ type Pipeline struct {
 	Output            PipelineOutput         `json:"output"`
 	Cache             []PipelineCache        `json:"cache"`
 	Scorer            string                 `json:"scorer"`
+	ScorerOptions     map[string]interface{} `json:"scorer_options"`
 	CLFOptions        rank.CLFOptions        `json:"clf"`
 	Headway           PipelineHeadway        `json:"headway"`
+	Checkpoint        PipelineCheckpoint     `json:"checkpoint"`
+	OnError           string                 `json:"on_error"`
+	Sweep             PipelineSweep          `json:"sweep"`
+	Cassette          PipelineCassette       `json:"cassette"`
 }
 
 // PipelineUtilities is used to reference external tools or files.
@@ -38,6 +43,34 @@ type PipelineCache struct {
 	Options map[string]interface{} `json:"options"`
 }
 
+// PipelineCheckpoint configures where the results of each topic are recorded, and whether to resume from them.
+type PipelineCheckpoint struct {
+	Path   string `json:"path"`
+	Resume bool   `json:"resume"`
+}
+
+// PipelineCassette configures whether the requests to remote services are recorded to, or replayed from, a cassette
+// directory.
+type PipelineCassette struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+}
+
+// PipelineSweep declares the axes of a parameter sweep over the pipeline, where each axis is a path into the DSL
+// (e.g. statistic.options.search.size) and the values to set it to.
+type PipelineSweep struct {
+	Axes    []SweepAxis `json:"axes"`
+	Output  string      `json:"output"`
+	Summary string      `json:"summary"`
+}
+
+// SweepAxis is a path into the DSL and the values it takes in a sweep.
+type SweepAxis struct {
+	Path   string        `json:"path"`
+	Name   string        `json:"name"`
+	Values []interface{} `json:"values"`
+}
+
 // PipelineLearning represents a configuration of a learning model.
 // The model specified in `model` is configured via `options`.
 //
@@ -63,6 +96,7 @@ type PipelineStatistic struct {
 	Source  string                   `json:"source"`
 	Options map[string]interface{}   `json:"options"`
 	Sources []map[string]interface{} `json:"sources"`
+	Merger  string                   `json:"merger"`
 }
 
 // PipelineOutput represents an output formatter in the DSL.
@@ -70,12 +104,16 @@ type PipelineOutput struct {
 	Measurements []MeasurementOutput `json:"measurements"`
 	Trec         TrecOutput          `json:"trec_results"`
 	Evaluations  EvaluationOutput    `json:"evaluations"`
+	Order        string              `json:"order"`
+	Errors       string              `json:"errors"`
+	Manifest     string              `json:"manifest"`
 }
 
 // MeasurementOutput represents an output format for measurements.
 type MeasurementOutput struct {
 	Format   string `json:"format"`
 	Filename string `json:"filename"`
+	Label    string `json:"label"`
 }
 
 // EvaluationOutput represents an output format for measurements.
@@ -83,12 +121,15 @@ type EvaluationOutput struct {
 	Qrels          string                   `json:"qrels"`
 	RelevanceGrade int64                    `json:"grade"`
 	Measurements   []EvaluationOutputFormat `json:"formats"`
+	Baseline       string                   `json:"baseline"`
+	Significance   string                   `json:"significance"`
 }
 
 // EvaluationOutputFormat represents how evaluations should be output.
 type EvaluationOutputFormat struct {
-	Format   string `json:"format"`
-	Filename string `json:"filename"`
+	Format    string `json:"format"`
+	Filename  string `json:"filename"`
+	Aggregate bool   `json:"aggregate"`
 }
 
 // TrecOutput represents an output for trec files.
@@ -0,0 +1,445 @@
+package boogie
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/query"
+	"github.com/hscells/groove/stats"
+	"gopkg.in/olivere/elastic.v5"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Secret is an option that can be read from an environment variable (env:NAME) or a file (file:path), so that it
+// does not have to be written in the pipeline. Any other value is used as-is.
+type Secret string
+
+// Resolve reads the value of the secret.
+func (s Secret) Resolve() (string, error) {
+	v := string(s)
+	switch {
+	case strings.HasPrefix(v, "env:"):
+		name := strings.TrimPrefix(v, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(v, "file:"):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(v, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return v, nil
+}
+
+// elasticsearchTransport adds the authentication configured for an Elasticsearch source to the requests made by its
+// client.
+type elasticsearchTransport struct {
+	base               http.RoundTripper
+	username, password string
+	apiKey             string
+}
+
+func (t *elasticsearchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests must not be modified by a transport.
+	req = req.Clone(req.Context())
+	if len(t.apiKey) > 0 {
+		req.Header.Set("Authorization", "ApiKey "+t.apiKey)
+	} else if len(t.username) > 0 {
+		req.SetBasicAuth(t.username, t.password)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// defaultTransport is the default HTTP transport, before it is wrapped to configure requests to Entrez.
+var defaultTransport = http.DefaultTransport.(*http.Transport)
+
+// newElasticsearchHTTPClient creates the HTTP client of an Elasticsearch source, with the authentication, TLS, and
+// timeout configured in its options.
+func newElasticsearchHTTPClient(options ElasticsearchOptions) (*http.Client, error) {
+	var (
+		t   = new(elasticsearchTransport)
+		err error
+	)
+	t.username, err = options.Username.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("elasticsearch username: %v", err)
+	}
+	t.password, err = options.Password.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("elasticsearch password: %v", err)
+	}
+	t.apiKey, err = options.APIKey.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("elasticsearch api_key: %v", err)
+	}
+
+	transport := defaultTransport.Clone()
+	if len(options.CACert) > 0 {
+		b, err := ioutil.ReadFile(options.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates could be read from the elasticsearch ca_cert %v", options.CACert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	if len(options.Timeout) > 0 {
+		timeout, err := time.ParseDuration(options.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("elasticsearch timeout %v must be a duration (e.g. 90s or 5m)", options.Timeout)
+		}
+		transport.ResponseHeaderTimeout = timeout
+	}
+	t.base = withCassette(transport)
+	return &http.Client{Transport: t}, nil
+}
+
+// newElasticsearchClient creates the client of an Elasticsearch source for its hosts. The nodes of the cluster are not
+// sniffed, so that every request is made to the configured hosts, with the configured HTTP client.
+func newElasticsearchClient(hosts []string, client *http.Client) (*elastic.Client, error) {
+	return elastic.NewClient(
+		elastic.SetURL(hosts...),
+		elastic.SetHttpClient(client),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false))
+}
+
+// elasticsearchClient sets the client of an Elasticsearch statistics source, in place of the client that groove
+// creates for its hosts (see stats.ElasticsearchHosts), which always uses the default HTTP client.
+func elasticsearchClient(client *elastic.Client) func(*stats.ElasticsearchStatisticsSource) {
+	return func(es *stats.ElasticsearchStatisticsSource) {
+		// groove does not export the client of the source.
+		f := reflect.ValueOf(es).Elem().FieldByName("client")
+		reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(reflect.ValueOf(client))
+	}
+}
+
+// Retrieval models of the elasticsearch source.
+const (
+	ModelBM25            = "bm25"
+	ModelLMDirichlet     = "lm_dirichlet"
+	ModelLMJelinekMercer = "lm_jelinek_mercer"
+)
+
+// elasticsearchTermVector is the response of the term vectors API for a field.
+type elasticsearchTermVector struct {
+	FieldStatistics struct {
+		DocCount float64 `json:"doc_count"`
+		SumTTF   float64 `json:"sum_ttf"`
+	} `json:"field_statistics"`
+	Terms map[string]struct {
+		TermFreq float64 `json:"term_freq"`
+		DocFreq  float64 `json:"doc_freq"`
+		TTF      float64 `json:"ttf"`
+	} `json:"terms"`
+}
+
+// ElasticsearchModelScorer scores documents with a retrieval model (BM25, or a Dirichlet or Jelinek-Mercer smoothed
+// language model), using the term vectors of an Elasticsearch index. The statistics of the query terms are found by
+// analysing the query as an artificial document, so that they are analysed in the same way as the field.
+type ElasticsearchModelScorer struct {
+	Model  string
+	Params map[string]float64
+	host   string
+	index  string
+	field  string
+	client *http.Client
+	// queries caches the term vector of each query.
+	queries map[string]elasticsearchTermVector
+	mu      sync.Mutex
+}
+
+// NewElasticsearchModelScorer creates a scorer for a retrieval model of the elasticsearch source, which requests term
+// vectors with client.
+func NewElasticsearchModelScorer(model string, params map[string]float64, host, index, field string, client *http.Client) (*ElasticsearchModelScorer, error) {
+	switch model {
+	case ModelBM25, ModelLMDirichlet, ModelLMJelinekMercer:
+	default:
+		return nil, fmt.Errorf("%v is not a known retrieval model (expected one of: bm25, lm_dirichlet, lm_jelinek_mercer)", model)
+	}
+	return &ElasticsearchModelScorer{
+		Model:   model,
+		Params:  params,
+		host:    strings.TrimSuffix(host, "/"),
+		index:   index,
+		field:   field,
+		client:  client,
+		queries: make(map[string]elasticsearchTermVector),
+	}, nil
+}
+
+// param is a parameter of the model, or its default.
+func (s *ElasticsearchModelScorer) param(name string, value float64) float64 {
+	if v, ok := s.Params[name]; ok {
+		return v
+	}
+	return value
+}
+
+// post makes a request to an endpoint of the index, decoding the response into v.
+func (s *ElasticsearchModelScorer) post(endpoint string, request, v interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(fmt.Sprintf("%s/%s/%s", s.host, url.PathEscape(s.index), endpoint), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("elasticsearch responded to %s with %s: %s", endpoint, resp.Status, string(b))
+	}
+	return json.Unmarshal(b, v)
+}
+
+// queryTermVector analyses the keywords of a query, finding the frequency of each term in the query and collection.
+func (s *ElasticsearchModelScorer) queryTermVector(query cqr.CommonQueryRepresentation) (elasticsearchTermVector, error) {
+	text := strings.Join(queryKeywords(query), " ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tv, ok := s.queries[text]; ok {
+		return tv, nil
+	}
+	var r struct {
+		TermVectors map[string]elasticsearchTermVector `json:"term_vectors"`
+	}
+	err := s.post("_termvectors", map[string]interface{}{
+		"doc":              map[string]string{s.field: text},
+		"fields":           []string{s.field},
+		"term_statistics":  true,
+		"field_statistics": true,
+		"positions":        false,
+		"offsets":          false,
+	}, &r)
+	if err != nil {
+		return elasticsearchTermVector{}, err
+	}
+	tv := r.TermVectors[s.field]
+	s.queries[text] = tv
+	return tv, nil
+}
+
+// elasticsearchTermVectorBatch is the number of documents whose term vectors are requested at once.
+const elasticsearchTermVectorBatch = 500
+
+// documentTermVectors requests the term vectors of documents, in batches.
+func (s *ElasticsearchModelScorer) documentTermVectors(docIds []string) (map[string]elasticsearchTermVector, error) {
+	vectors := make(map[string]elasticsearchTermVector, len(docIds))
+	for i := 0; i < len(docIds); i += elasticsearchTermVectorBatch {
+		j := i + elasticsearchTermVectorBatch
+		if j > len(docIds) {
+			j = len(docIds)
+		}
+		var r struct {
+			Docs []struct {
+				ID          string                             `json:"_id"`
+				TermVectors map[string]elasticsearchTermVector `json:"term_vectors"`
+			} `json:"docs"`
+		}
+		err := s.post("_mtermvectors", map[string]interface{}{
+			"ids": docIds[i:j],
+			"parameters": map[string]interface{}{
+				"fields":           []string{s.field},
+				"term_statistics":  false,
+				"field_statistics": false,
+				"positions":        false,
+				"offsets":          false,
+			},
+		}, &r)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range r.Docs {
+			vectors[doc.ID] = doc.TermVectors[s.field]
+		}
+	}
+	return vectors, nil
+}
+
+// rank requests the term vectors of every document of a run at once, rather than one request for each document.
+func (s *ElasticsearchModelScorer) rank(_ stats.StatisticsSource, docIds []string, _ []string) (Scorer, error) {
+	vectors, err := s.documentTermVectors(docIds)
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearchModelRanking{scorer: s, vectors: vectors}, nil
+}
+
+func (s *ElasticsearchModelScorer) Score(query cqr.CommonQueryRepresentation, docId string, fields ...string) (float64, error) {
+	vectors, err := s.documentTermVectors([]string{docId})
+	if err != nil {
+		return 0, err
+	}
+	return s.score(query, vectors[docId])
+}
+
+// score scores a document, with term vector d, for a query.
+func (s *ElasticsearchModelScorer) score(query cqr.CommonQueryRepresentation, d elasticsearchTermVector) (float64, error) {
+	q, err := s.queryTermVector(query)
+	if err != nil {
+		return 0, err
+	}
+
+	var length float64
+	for _, t := range d.Terms {
+		length += t.TermFreq
+	}
+	N, C := q.FieldStatistics.DocCount, q.FieldStatistics.SumTTF
+	if N == 0 || C == 0 {
+		return 0, nil
+	}
+
+	var score float64
+	for term, t := range q.Terms {
+		tf := d.Terms[term].TermFreq
+		switch s.Model {
+		case ModelBM25:
+			k1, b := s.param("k1", 1.2), s.param("b", 0.75)
+			idf := math.Log(1 + (N-t.DocFreq+0.5)/(t.DocFreq+0.5))
+			score += t.TermFreq * idf * (tf * (k1 + 1)) / (tf + k1*(1-b+b*length/(C/N)))
+		case ModelLMDirichlet:
+			if t.TTF == 0 {
+				continue
+			}
+			mu := s.param("mu", 2000)
+			score += t.TermFreq * math.Log((tf+mu*t.TTF/C)/(length+mu))
+		case ModelLMJelinekMercer:
+			if t.TTF == 0 || length == 0 {
+				continue
+			}
+			lambda := s.param("lambda", 0.5)
+			score += t.TermFreq * math.Log((1-lambda)*tf/length+lambda*t.TTF/C)
+		}
+	}
+	return score, nil
+}
+
+// elasticsearchModelRanking scores the documents of a run with the term vectors requested for them.
+type elasticsearchModelRanking struct {
+	scorer  *ElasticsearchModelScorer
+	vectors map[string]elasticsearchTermVector
+}
+
+func (r elasticsearchModelRanking) Score(query cqr.CommonQueryRepresentation, docId string, fields ...string) (float64, error) {
+	return r.scorer.score(query, r.vectors[docId])
+}
+
+// newElasticsearchModelScorer creates the scorer of the retrieval model of an elasticsearch source, if one is
+// configured. The term vectors of the field searched by the source are scored (text by default).
+func newElasticsearchModelScorer(options ElasticsearchOptions) (Scorer, error) {
+	if len(options.Model) == 0 {
+		return nil, nil
+	}
+	client, err := newElasticsearchHTTPClient(options)
+	if err != nil {
+		return nil, err
+	}
+	field := "text"
+	if len(options.Field) > 0 {
+		field = options.Field
+	}
+	return NewElasticsearchModelScorer(options.Model, options.Params, options.hosts()[0], options.index(), field, client)
+}
+
+// ElasticsearchSearch is how an elasticsearch source searches; the field searched in place of the fields of the
+// keywords of queries (if any), and the scorer of the retrieval model that re-ranks its runs (if any).
+type ElasticsearchSearch struct {
+	Field string
+	Model Scorer
+}
+
+// NewElasticsearchSearch creates how a statistic source searches from its configuration. Only elasticsearch sources
+// search differently to groove.
+func NewElasticsearchSearch(source string, config map[string]interface{}) (ElasticsearchSearch, error) {
+	if source != "elasticsearch" {
+		return ElasticsearchSearch{}, nil
+	}
+	var options ElasticsearchOptions
+	err := decodeOptions("elasticsearch", config, &options)
+	if err != nil {
+		return ElasticsearchSearch{}, err
+	}
+	model, err := newElasticsearchModelScorer(options)
+	if err != nil {
+		return ElasticsearchSearch{}, err
+	}
+	return ElasticsearchSearch{Field: options.Field, Model: model}, nil
+}
+
+// searchField replaces the fields of every keyword of a query with field, so that it is compiled to a search of field.
+func searchField(query cqr.CommonQueryRepresentation, field string) cqr.CommonQueryRepresentation {
+	switch q := query.(type) {
+	case cqr.Keyword:
+		q.Fields = []string{field}
+		return q
+	case cqr.BooleanQuery:
+		children := make([]cqr.CommonQueryRepresentation, len(q.Children))
+		for i, child := range q.Children {
+			children[i] = searchField(child, field)
+		}
+		q.Children = children
+		return q
+	}
+	return query
+}
+
+// FieldQueriesSource is a query source whose queries search a field in place of the fields of their keywords.
+type FieldQueriesSource struct {
+	query.QueriesSource
+	Field string
+}
+
+func (f FieldQueriesSource) Load(directory string) ([]pipeline.Query, error) {
+	queries, err := f.QueriesSource.Load(directory)
+	if err != nil {
+		return nil, err
+	}
+	for i, q := range queries {
+		queries[i].Query = searchField(q.Query, f.Field)
+	}
+	return queries, nil
+}
+
+// queryKeywords are the keywords of a query, excluding those that are prohibited.
+func queryKeywords(query cqr.CommonQueryRepresentation) []string {
+	var keywords []string
+	switch x := query.(type) {
+	case cqr.Keyword:
+		keywords = append(keywords, x.QueryString)
+	case cqr.BooleanQuery:
+		for i, child := range x.Children {
+			if strings.ToLower(x.Operator) == cqr.NOT && i > 0 {
+				continue
+			}
+			keywords = append(keywords, queryKeywords(child)...)
+		}
+	}
+	return keywords
+}
@@ -0,0 +1,151 @@
+package boogie
+
+import (
+	"encoding/pem"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/trecresults"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestElasticsearchClient(t *testing.T) {
+	var paths, auths []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		auths = append(auths, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"count": 3}`)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "boogie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("BOOGIE_TEST_ES_API_KEY", "secret")
+	defer os.Unsetenv("BOOGIE_TEST_ES_API_KEY")
+
+	es, err := NewElasticsearchStatisticsSource(map[string]interface{}{
+		"hosts":   []interface{}{srv.URL},
+		"index":   "pubmed",
+		"api_key": "env:BOOGIE_TEST_ES_API_KEY",
+		"ca_cert": ca,
+		"timeout": "5s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := es.RetrievalSize(cqr.NewKeyword("heart", "text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("RetrievalSize() = %v, want 3", n)
+	}
+
+	// The cluster is not sniffed, so the only request is the count, and it is authenticated.
+	if len(paths) != 1 || paths[0] != "/pubmed/_count" {
+		t.Errorf("requests = %v, want [/pubmed/_count]", paths)
+	}
+	if len(auths) != 1 || auths[0] != "ApiKey secret" {
+		t.Errorf("Authorization = %v, want [ApiKey secret]", auths)
+	}
+	if http.DefaultClient.Transport != nil {
+		t.Errorf("the transport of the default client was replaced with %T", http.DefaultClient.Transport)
+	}
+}
+
+func TestElasticsearchModelScorerRank(t *testing.T) {
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/pubmed/_termvectors":
+			fmt.Fprint(w, `{"term_vectors": {"title": {
+				"field_statistics": {"doc_count": 10, "sum_ttf": 100},
+				"terms": {"heart": {"term_freq": 1, "doc_freq": 2, "ttf": 5}}}}}`)
+		case "/pubmed/_mtermvectors":
+			fmt.Fprint(w, `{"docs": [
+				{"_id": "1", "term_vectors": {"title": {"terms": {"heart": {"term_freq": 1}, "attack": {"term_freq": 1}}}}},
+				{"_id": "2", "term_vectors": {"title": {"terms": {"heart": {"term_freq": 3}}}}},
+				{"_id": "3", "term_vectors": {"title": {"terms": {"panic": {"term_freq": 1}}}}}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	search, err := NewElasticsearchSearch("elasticsearch", map[string]interface{}{
+		"hosts": []interface{}{srv.URL},
+		"index": "pubmed",
+		"field": "title",
+		"model": ModelBM25,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results trecresults.ResultList
+	for _, id := range []string{"1", "2", "3"} {
+		results = append(results, &trecresults.Result{Topic: "1", DocId: id})
+	}
+	results, err = Reranker{Scorer: search.Model}.Rerank(cqr.NewKeyword("heart", "title"), results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var docs []string
+	for _, r := range results {
+		docs = append(docs, r.DocId)
+	}
+	if want := []string{"2", "1", "3"}; !reflect.DeepEqual(docs, want) {
+		t.Errorf("Rerank() = %v, want %v", docs, want)
+	}
+	// The term vectors of every document are requested at once.
+	if want := map[string]int{"/pubmed/_termvectors": 1, "/pubmed/_mtermvectors": 1}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestFieldQueriesSource(t *testing.T) {
+	q := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("heart", "title", "abstract"),
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{cqr.NewKeyword("attack", "mesh_headings")}),
+	})
+	source := FieldQueriesSource{QueriesSource: testQueriesSource{pipeline.NewQuery("1", "1", q)}, Field: "text"}
+	queries, err := source.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("heart", "text"),
+		cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{cqr.NewKeyword("attack", "text")}),
+	})
+	if len(queries) != 1 || !reflect.DeepEqual(queries[0].Query, want) {
+		t.Errorf("Load() = %v, want %v", queries, want)
+	}
+	// The query that was loaded is not modified.
+	if got := q.Children[0].(cqr.Keyword).Fields; !reflect.DeepEqual(got, []string{"title", "abstract"}) {
+		t.Errorf("fields of the loaded query = %v, want [title abstract]", got)
+	}
+}
+
+// testQueriesSource is a query source of fixed queries.
+type testQueriesSource []pipeline.Query
+
+func (s testQueriesSource) Load(directory string) ([]pipeline.Query, error) {
+	return append([]pipeline.Query(nil), s...), nil
+}
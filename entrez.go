@@ -0,0 +1,206 @@
+package boogie
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entrezHost is the host of the Entrez E-utilities.
+const entrezHost = "eutils.ncbi.nlm.nih.gov"
+
+// entrezTransport limits the rate of requests to Entrez, and retries requests that fail with a 429 (too many
+// requests) or 5xx response, waiting exponentially longer between each attempt. Requests to any other host are sent
+// unchanged.
+type entrezTransport struct {
+	base http.RoundTripper
+	// local answers the requests of a tool in place of Entrez (i.e. a store of the PubMed baseline).
+	local map[string]http.RoundTripper
+	// configured is whether the rate and retries have been set by an entrez source.
+	configured bool
+	rate       float64
+	interval   time.Duration
+	retries    int
+	// next is when the next request may be sent.
+	next time.Time
+	mu   sync.Mutex
+}
+
+// wait blocks until a request can be sent without exceeding the rate limit. Replayed requests are not sent to
+// Entrez, so they do not wait.
+func (t *entrezTransport) wait() {
+	if replaying() {
+		return
+	}
+	t.mu.Lock()
+	at := t.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	t.next = at.Add(t.interval)
+	t.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+func (t *entrezTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != entrezHost {
+		return t.base.RoundTrip(req)
+	}
+	t.mu.Lock()
+	retries, hasLocal := t.retries, len(t.local) > 0
+	t.mu.Unlock()
+	if hasLocal {
+		tool, r, err := entrezTool(req)
+		if err != nil {
+			return nil, err
+		}
+		req = r
+		t.mu.Lock()
+		local := t.local[tool]
+		t.mu.Unlock()
+		if local != nil {
+			return local.RoundTrip(req)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		t.wait()
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return resp, nil
+		}
+
+		delay := time.Second << uint(attempt)
+		if err == nil {
+			if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				delay = time.Duration(s) * time.Second
+			}
+			b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			err = fmt.Errorf("entrez responded with %s: %s", resp.Status, strings.TrimSpace(string(b)))
+		}
+		if attempt >= retries || req.Context().Err() != nil || isUnrecorded(err) {
+			return nil, err
+		}
+
+		// The body of a request must be read again to be retried.
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		if replaying() {
+			delay = 0
+		}
+		log.Printf("retrying failed entrez request in %v (attempt %d of %d): %v\n", delay, attempt+1, retries, err)
+		time.Sleep(delay)
+	}
+}
+
+// entrezTool is the tool making a request, which is sent in the body of requests that are too long for a URL. When the
+// body is read, the request is returned with a copy of it.
+func entrezTool(req *http.Request) (string, *http.Request, error) {
+	if tool := req.URL.Query().Get("tool"); len(tool) > 0 || req.Body == nil || req.Body == http.NoBody {
+		return tool, req, nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Body.Close()
+	req = req.Clone(req.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return "", req, nil
+	}
+	return values.Get("tool"), req, nil
+}
+
+// useLocalEntrez answers the Entrez requests of a tool with local.
+func useLocalEntrez(tool string, local http.RoundTripper) {
+	t := installTransport()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.local == nil {
+		t.local = make(map[string]http.RoundTripper)
+	}
+	t.local[tool] = local
+}
+
+// configureEntrez configures the rate limit and retries of requests to Entrez. NCBI limits the requests of each user
+// to 3 per second, or 10 per second with an API key, so the settings are shared by every entrez source of the process:
+// they are set by the first entrez source, and the options of any other source must be unset or the same.
+// groove requests Entrez with the default HTTP transport, so requests are configured by wrapping it (see
+// installTransport).
+func configureEntrez(options EntrezOptions) error {
+	limit := 3.0
+	if len(options.Key) > 0 {
+		limit = 10
+	}
+	rate := limit
+	if options.RequestsPerSecond != nil {
+		rate = *options.RequestsPerSecond
+		if rate <= 0 || rate > limit {
+			return fmt.Errorf("entrez requests_per_second must be greater than 0 and at most %v (3 without a key, 10 with one), got %v", limit, rate)
+		}
+	}
+	retries := 5
+	if options.Retries != nil {
+		retries = *options.Retries
+		if retries < 0 {
+			return fmt.Errorf("entrez retries must not be negative, got %d", retries)
+		}
+	}
+
+	t := installTransport()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.configured {
+		if options.RequestsPerSecond != nil && rate != t.rate {
+			return fmt.Errorf("entrez requests_per_second %v conflicts with %v of another entrez source, and the rate limit is shared by every entrez source", rate, t.rate)
+		}
+		if options.Retries != nil && retries != t.retries {
+			return fmt.Errorf("entrez retries %d conflicts with %d of another entrez source, and retries are shared by every entrez source", retries, t.retries)
+		}
+		return nil
+	}
+	t.configured = true
+	t.rate = rate
+	t.interval = time.Duration(float64(time.Second) / rate)
+	t.retries = retries
+	return nil
+}
+
+var (
+	remoteTransport *entrezTransport
+	remoteOnce      sync.Once
+)
+
+// installTransport wraps the default HTTP transport, once, so that the requests groove and other libraries make to
+// remote services are sent through the Entrez transport and then the cassette in use. Both are resolved as each
+// request is made, so it does not matter whether a cassette is used before or after an entrez source is configured.
+func installTransport() *entrezTransport {
+	remoteOnce.Do(func() {
+		remoteTransport = &entrezTransport{base: withCassette(http.DefaultTransport)}
+		http.DefaultTransport = remoteTransport
+	})
+	return remoteTransport
+}
@@ -2,9 +2,14 @@ package boogie
 
 import (
 	"bytes"
-	"github.com/hscells/groove/output"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hscells/groove"
+	"github.com/hscells/groove/eval"
 	"github.com/hscells/groove/pipeline"
 	"github.com/hscells/transmute"
+	"github.com/hscells/trecresults"
 	"io/ioutil"
 	"log"
 	"os"
@@ -14,57 +19,200 @@ import (
 	"strings"
 )
 
+// Run is a groove pipeline created from the DSL, and what boogie does with the run of each topic once groove has
+// retrieved it.
+type Run struct {
+	DSL      Pipeline
+	Pipeline groove.Pipeline
+	// Report is the errors of the topics that failed during the run.
+	Report *ErrorReport
+
+	// fusion fuses the run of each topic with the runs of other sources, and reranker re-ranks it. The run is then
+	// evaluated using evaluators in place of groove.
+	fusion     *Fusion
+	reranker   *Reranker
+	evaluators []eval.Evaluator
+}
+
+// NewRun creates the groove pipeline of the DSL.
+func NewRun(dsl Pipeline) (*Run, error) {
+	r := &Run{DSL: dsl, Report: new(ErrorReport)}
+	g, err := createPipeline(dsl, r)
+	if err != nil {
+		return nil, err
+	}
+	r.Pipeline = g
+	return r, nil
+}
+
+// Execute executes the groove pipeline, and writes its results to the outputs of the DSL.
+func (r *Run) Execute() error {
+	_, err := r.run()
+	return err
+}
+
+// run executes the groove pipeline, and returns the evaluations of the topics without errors.
+func (r *Run) run() (map[string]map[string]float64, error) {
+	pipelineChannel := make(chan pipeline.Result)
+	go r.Pipeline.Execute(pipelineChannel)
+	return r.execute(pipelineChannel)
+}
+
+// postprocessed reports whether the run of each topic is changed by boogie once it has been retrieved.
+func (r *Run) postprocessed() bool {
+	return r.fusion != nil || r.reranker != nil
+}
+
+// Execute writes the results of a groove pipeline created with CreatePipeline to the outputs of the DSL. Pipelines
+// that re-rank or fuse the run of each topic must be executed with a Run instead.
 func Execute(dsl Pipeline, pipelineChannel chan pipeline.Result) error {
+	if len(dsl.Scorer) > 0 || len(dsl.Statistic.Sources) > 0 {
+		return fmt.Errorf("a pipeline with a scorer or sources must be executed with a Run (see NewRun)")
+	}
+	_, err := (&Run{DSL: dsl, Report: new(ErrorReport)}).execute(pipelineChannel)
+	return err
+}
+
+// execute writes the results of a groove pipeline to the outputs of the DSL, and returns the evaluations of the
+// topics without errors.
+func (r *Run) execute(pipelineChannel chan pipeline.Result) (map[string]map[string]float64, error) {
+	dsl := r.DSL
 	// Handle the case if the method is not run as a command.s
 	if measurementMapping == nil || len(measurementMapping) == 0 {
 		err := RegisterSources(dsl)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	// File that will contain TREC run data.
+	// File that will contain TREC run data. It is rewritten in full on every run, so re-running never duplicates
+	// results.
 	var trecEvalFile *os.File
 	if len(dsl.Output.Trec.Output) > 0 {
 		var err error
-		trecEvalFile, err = os.OpenFile(dsl.Output.Trec.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		trecEvalFile, err = os.OpenFile(dsl.Output.Trec.Output, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	policy, err := NewErrorPolicy(dsl.OnError)
+	if err != nil {
+		return nil, err
+	}
+	if r.fusion != nil {
+		defer r.fusion.Close()
+	}
+	// The error that aborted the run, once the results of the other topics have been written.
+	var abort error
+
+	// Topics are output in a stable order.
+	order, err := NewTopicOrder(dsl)
+	if err != nil {
+		return nil, err
+	}
+	topicOrder = order
+
 	measurements := make(map[string]map[string]float64)
 	evaluations := make(map[string]map[string]float64)
+	// TREC results are kept until the end so they can be written in order.
+	trecResults := make(map[string][]string)
+	transformations := make(map[string][]string)
+	// Topics seen in this run, whose results replace any restored from a previous attempt.
+	retrieved := make(map[string]bool)
+	transformed := make(map[string]bool)
+	// The runs and queries of topics, when runs are changed once they have been retrieved.
+	runs := make(map[string]trecresults.ResultList)
+	queries := make(map[string]pipeline.Query)
+
+	// The results of each topic are checkpointed so an interrupted run can be resumed.
+	checkpoint, err := NewCheckpoint(dsl)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint != nil && dsl.Checkpoint.Resume {
+		err = checkpoint.Restore(measurements, evaluations, trecResults, transformations)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	defer trecEvalFile.Close()
+results:
 	for result := range pipelineChannel {
 		switch result.Type {
 		case pipeline.Measurement:
-			measurements[result.Topic] = result.Measurements
+			measurements[result.Topic] = make(map[string]float64, len(result.Measurements))
+			for name, v := range result.Measurements {
+				measurements[result.Topic][measurementName(name)] = v
+			}
+			if checkpoint != nil && !r.Report.HasFailed(result.Topic) {
+				err := checkpoint.Save(CheckpointMeasurement, result.Topic, measurements[result.Topic])
+				if err != nil {
+					return nil, err
+				}
+			}
 		case pipeline.Evaluation:
 			evaluations[result.Topic] = result.Evaluations
+			if checkpoint != nil && !r.Report.HasFailed(result.Topic) {
+				err := checkpoint.Save(CheckpointEvaluation, result.Topic, result.Evaluations)
+				if err != nil {
+					return nil, err
+				}
+			}
 		case pipeline.Transformation:
+			// The query of each topic is kept, as its run is fused and re-ranked for it.
+			if r.postprocessed() {
+				t := result.Transformation
+				queries[t.Topic] = pipeline.NewQuery(t.Name, t.Topic, t.Transformation)
+			}
 			// Output the transformed queries
 			if len(dsl.Transformations.Output) > 0 {
 				s, err := transmute.CompileCqr2PubMed(result.Transformation.Transformation)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				q := bytes.NewBufferString(s).Bytes()
 				err = ioutil.WriteFile(filepath.Join(dsl.Transformations.Output, result.Transformation.Name), q, 0644)
 				if err != nil {
-					return err
+					return nil, err
+				}
+				if checkpoint != nil && len(result.Topic) > 0 {
+					if !transformed[result.Topic] {
+						transformed[result.Topic] = true
+						transformations[result.Topic] = nil
+					}
+					transformations[result.Topic] = append(transformations[result.Topic], result.Transformation.Name)
+					err = checkpoint.Save(CheckpointTransformation, result.Topic, transformations[result.Topic])
+					if err != nil {
+						return nil, err
+					}
 				}
 			}
 		case pipeline.TrecResult:
+			// Runs that are changed once they have been retrieved are output afterwards.
+			if r.postprocessed() && result.TrecResults != nil {
+				runs[result.Topic] = *result.TrecResults
+				result.TrecResults = nil
+				continue
+			}
 			if result.TrecResults != nil && len(*result.TrecResults) > 0 {
-				l := make([]string, len(*result.TrecResults))
-				for i, r := range *result.TrecResults {
-					l[i] = r.String()
+				topics := make(map[string]bool)
+				for _, t := range *result.TrecResults {
+					if !retrieved[t.Topic] {
+						retrieved[t.Topic] = true
+						trecResults[t.Topic] = nil
+					}
+					trecResults[t.Topic] = append(trecResults[t.Topic], t.String())
+					topics[t.Topic] = true
 				}
-				_, err := trecEvalFile.Write([]byte(strings.Join(l, "\n") + "\n"))
-				if err != nil {
-					return err
+				for topic := range topics {
+					if checkpoint != nil && !r.Report.HasFailed(topic) {
+						err := checkpoint.Save(CheckpointTrecResults, topic, trecResults[topic])
+						if err != nil {
+							return nil, err
+						}
+					}
 				}
 				result.TrecResults = nil
 			}
@@ -73,7 +221,7 @@ func Execute(dsl Pipeline, pipelineChannel chan pipeline.Result) error {
 				// Create the folder the data will be contained in.
 				err := os.MkdirAll(path.Join(dsl.Formulation.Method, s.Name), 0777)
 				if err != nil {
-					return err
+					return nil, err
 				}
 
 				for _, d := range s.Data {
@@ -81,22 +229,22 @@ func Execute(dsl Pipeline, pipelineChannel chan pipeline.Result) error {
 					// Create and open the file that will contain the data.
 					f, err := os.OpenFile(path.Join(dsl.Formulation.Method, s.Name, d.Name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
 					if err != nil {
-						return err
+						return nil, err
 					}
 					// Marshal the data into bytes for writing to disk.
 					b, err := d.Value.Marshal()
 					if err != nil {
-						return err
+						return nil, err
 					}
 					// Write those bytes to disk.
 					_, err = f.Write(b)
 					if err != nil {
-						return err
+						return nil, err
 					}
 					// Close that file.
 					err = f.Close()
 					if err != nil {
-						return err
+						return nil, err
 					}
 				}
 			}
@@ -104,63 +252,179 @@ func Execute(dsl Pipeline, pipelineChannel chan pipeline.Result) error {
 			// Create the folder that will contain the formulated query/queries.
 			err := os.MkdirAll(dsl.Formulation.Method, 0777)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			for i, q := range result.Formulation.Queries {
 				log.Println(q)
 				err := os.MkdirAll(path.Join(dsl.Formulation.Method, strconv.Itoa(i)), 0777)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				// Compile the query to CQR.
 				s, err := transmute.CompileCqr2PubMed(q)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				// Open the file that will contain the query.
 				f, err := os.OpenFile(path.Join(dsl.Formulation.Method, strconv.Itoa(i), result.Topic), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				// Write the query to disk.
 				_, err = f.WriteString(s)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				// Close the file.
 				err = f.Close()
 				if err != nil {
-					return err
+					return nil, err
 				}
 			}
 		case pipeline.Error:
-			if len(result.Topic) > 0 {
-				log.Printf("an error occurred in topic %v", result.Topic)
+			// groove does not attribute the errors of measurements to a topic, but stops computing measurements at
+			// the first that fails, so they always abort the run.
+			var m measurementError
+			measured := errors.As(result.Error, &m)
+			topic := result.Topic
+			if measured {
+				topic = m.topic
+			}
+			if len(topic) > 0 {
+				log.Printf("an error occurred in topic %v", topic)
 			} else {
 				log.Println("an error occurred")
 			}
-			return result.Error
+			r.Report.Add(topic, result.Error)
+			// Errors that cannot be attributed to a topic always abort the run.
+			if policy.Abort || len(topic) == 0 || measured {
+				abort = result.Error
+				break results
+			}
+		}
+	}
+
+	// Runs are fused and re-ranked, and then evaluated, once every topic has been retrieved.
+	if r.postprocessed() {
+		topics := make([]string, 0, len(runs))
+		for topic := range runs {
+			if !r.Report.HasFailed(topic) {
+				topics = append(topics, topic)
+			}
+		}
+		sortTopics(topics)
+		for _, topic := range topics {
+			var results trecresults.ResultList
+			if query, ok := queries[topic]; ok {
+				results, err = r.postprocess(query, runs[topic])
+			} else {
+				err = fmt.Errorf("no query was retrieved for topic %v", topic)
+			}
+			if err != nil {
+				log.Printf("an error occurred in topic %v", topic)
+				r.Report.Add(topic, err)
+				if policy.Abort && abort == nil {
+					abort = err
+				}
+				continue
+			}
+			trecResults[topic] = make([]string, len(results))
+			for i, result := range results {
+				trecResults[topic][i] = result.String()
+			}
+			if len(r.evaluators) > 0 {
+				evaluations[topic] = eval.Evaluate(r.evaluators, &results, r.Pipeline.EvaluationFormatters.EvaluationQrels, topic)
+			}
+			if checkpoint != nil {
+				err := checkpoint.Save(CheckpointTrecResults, topic, trecResults[topic])
+				if err != nil {
+					return nil, err
+				}
+				if len(r.evaluators) > 0 {
+					err = checkpoint.Save(CheckpointEvaluation, topic, evaluations[topic])
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	// Only the results of topics without errors are output.
+	failed := r.Report.Failed()
+	removeFailedTopics(failed, measurements, evaluations, trecResults)
+	if r.fusion != nil {
+		err = r.fusion.WriteRuns(failed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(dsl.Output.Errors) > 0 {
+		err := r.Report.Write(dsl.Output.Errors)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(failed) > 0 && abort == nil {
+		log.Printf("%d topics failed and were skipped\n", len(failed))
+	}
+
+	if trecEvalFile != nil && len(trecResults) > 0 {
+		topics := make([]string, 0, len(trecResults))
+		for topic := range trecResults {
+			topics = append(topics, topic)
+		}
+		sortTopics(topics)
+		for _, topic := range topics {
+			_, err := trecEvalFile.Write([]byte(strings.Join(trecResults[topic], "\n") + "\n"))
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	if len(evaluations) > 0 {
 		for _, formatter := range dsl.Output.Evaluations.Measurements {
-			var f output.EvaluationFormatter
-			switch formatter.Format {
-			case "json":
-				f = output.JsonEvaluationFormatter
-			default:
-				log.Println("unexpected evaluation formatter, using json")
-				f = output.JsonEvaluationFormatter
+			f, ok := evaluationFormatters[formatter.Format]
+			if !ok {
+				return nil, fmt.Errorf("%v is not a known evaluation output format", formatter.Format)
 			}
 
-			formatted, err := f(evaluations)
+			// Rows for the mean, median and standard deviation of each measure can be added.
+			results := evaluations
+			if formatter.Aggregate {
+				results = make(map[string]map[string]float64)
+				for topic, v := range evaluations {
+					results[topic] = v
+				}
+				for topic, v := range AggregateEvaluations(evaluations) {
+					results[topic] = v
+				}
+			}
+
+			formatted, err := f(results)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			err = ioutil.WriteFile(formatter.Filename, bytes.NewBufferString(formatted).Bytes(), 0644)
 			if err != nil {
-				return err
+				return nil, err
+			}
+		}
+
+		// Compare the evaluations to a previous run.
+		if len(dsl.Output.Evaluations.Baseline) > 0 {
+			baseline, err := LoadEvaluations(dsl.Output.Evaluations.Baseline)
+			if err != nil {
+				return nil, err
+			}
+			b, err := json.MarshalIndent(CompareEvaluations(evaluations, baseline), "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			err = ioutil.WriteFile(dsl.Output.Evaluations.Significance, b, 0644)
+			if err != nil {
+				return nil, err
 			}
 		}
 	}
@@ -172,7 +436,7 @@ func Execute(dsl Pipeline, pipelineChannel chan pipeline.Result) error {
 			topics[i] = topic
 			i++
 		}
-		i = 0
+		sortTopics(topics)
 		headers := make([]string, len(dsl.Measurements))
 		data := make([][]float64, len(dsl.Measurements))
 		for i, measure := range dsl.Measurements {
@@ -189,21 +453,82 @@ func Execute(dsl Pipeline, pipelineChannel chan pipeline.Result) error {
 				r   string
 				err error
 			)
-			switch formatter.Format {
-			case "csv":
-				r, err = output.CsvMeasurementFormatter(topics, headers, data)
-			case "json":
-				r, err = output.JsonMeasurementFormatter(topics, headers, data)
+			if f, ok := measurementFormatters[formatter.Format]; ok {
+				r, err = f(topics, headers, data)
+			} else if f, ok := labelledMeasurementFormatters[formatter.Format]; ok {
+				var labels []float64
+				labels, err = measurementLabels(dsl, formatter.Label, topics, evaluations)
+				if err != nil {
+					return nil, err
+				}
+				r, err = f(topics, headers, data, labels)
+			} else {
+				return nil, fmt.Errorf("%v is not a known measurement output format", formatter.Format)
 			}
 			if err != nil {
-				return err
+				return nil, err
 			}
 			err = ioutil.WriteFile(formatter.Filename, bytes.NewBufferString(r).Bytes(), 0644)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
 
-	return nil
+	return evaluations, abort
+}
+
+// postprocess fuses, and then re-ranks, the run of a topic for its query.
+func (r *Run) postprocess(query pipeline.Query, results trecresults.ResultList) (trecresults.ResultList, error) {
+	var err error
+	if r.fusion != nil {
+		results, err = r.fusion.Fuse(query, results)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.reranker != nil {
+		return r.reranker.Rerank(query.Query, results)
+	}
+	return results, nil
+}
+
+// measurementLabels creates the label of each topic for labelled measurement formatters.
+// The label is either the number of relevant documents in the qrels (`qrels`), or the evaluation of the topic using
+// one of the evaluation measurements of the pipeline (e.g. `recall`).
+func measurementLabels(dsl Pipeline, label string, topics []string, evaluations map[string]map[string]float64) ([]float64, error) {
+	labels := make([]float64, len(topics))
+	switch label {
+	case "":
+		return nil, fmt.Errorf("a label must be specified for labelled measurement output formats")
+	case "qrels":
+		b, err := ioutil.ReadFile(dsl.Output.Evaluations.Qrels)
+		if err != nil {
+			return nil, err
+		}
+		qrels, err := trecresults.QrelsFromReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		for i, topic := range topics {
+			for _, line := range qrels.Qrels[topic] {
+				if line.Score > eval.RelevanceGrade {
+					labels[i]++
+				}
+			}
+		}
+	default:
+		e, ok := evaluationMapping[label]
+		if !ok {
+			return nil, fmt.Errorf("%v is not a known evaluation measurement for labels", label)
+		}
+		for i, topic := range topics {
+			v, ok := evaluations[topic][e.Name()]
+			if !ok {
+				return nil, fmt.Errorf("topic %s has no evaluation for label %v", topic, label)
+			}
+			labels[i] = v
+		}
+	}
+	return labels, nil
 }
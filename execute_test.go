@@ -0,0 +1,79 @@
+package boogie
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestPipeline writes the test MEDLINE collection, and a keyword query for each topic, to a temporary directory.
+// It returns a pipeline that retrieves the queries from the collection with the local source, the directory, and a
+// function that removes it. groove caches to the user cache directory, which is set to the directory until then.
+func newTestPipeline(t *testing.T, queries map[string]string) (Pipeline, string, func()) {
+	dir, err := ioutil.TempDir("", "boogie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheHome, ok := os.LookupEnv("XDG_CACHE_HOME")
+	cleanup := func() {
+		if ok {
+			os.Setenv("XDG_CACHE_HOME", cacheHome)
+		} else {
+			os.Unsetenv("XDG_CACHE_HOME")
+		}
+		os.RemoveAll(dir)
+	}
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+	collection := filepath.Join(dir, "collection.txt")
+	err = ioutil.WriteFile(collection, []byte(testMEDLINECollection), 0644)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "queries"), 0755)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	for topic, q := range queries {
+		err = ioutil.WriteFile(filepath.Join(dir, "queries", topic), []byte(q), 0644)
+		if err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+
+	dsl := Pipeline{
+		Query: PipelineQuery{Format: "keyword", Path: filepath.Join(dir, "queries")},
+		Statistic: PipelineStatistic{
+			Source: "local",
+			Options: map[string]interface{}{
+				"collection": collection,
+				"format":     CollectionMEDLINE,
+				"index":      filepath.Join(dir, "index"),
+			},
+		},
+		Output: PipelineOutput{Trec: TrecOutput{Output: filepath.Join(dir, "run.trec")}},
+	}
+	return dsl, dir, cleanup
+}
+
+// readTestRun reads the documents of each topic of a trec run in order.
+func readTestRun(t *testing.T, filename string) map[string][]string {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		run[fields[0]] = append(run[fields[0]], fields[2])
+	}
+	return run
+}
@@ -0,0 +1,171 @@
+package boogie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"path/filepath"
+	"strings"
+)
+
+// Formats that pipeline files can be written in.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// PipelineFormat determines the format of a pipeline file from its extension (.yaml, .yml, or .toml). Any other file
+// is JSON.
+func PipelineFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatJSON
+}
+
+// ValidFormat reports an error if format is not a known pipeline format.
+func ValidFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatYAML, FormatTOML:
+		return nil
+	}
+	return fmt.Errorf("%v is not a known pipeline format (expected one of: json, yaml, toml)", format)
+}
+
+// normaliseDocument converts the maps and lists decoded from YAML and TOML into those decoded from JSON.
+func normaliseDocument(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, item := range x {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("keys must be strings, found %v", k)
+			}
+			n, err := normaliseDocument(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = n
+		}
+		return m, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for key, item := range x {
+			n, err := normaliseDocument(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = n
+		}
+		return m, nil
+	case []map[string]interface{}:
+		l := make([]interface{}, len(x))
+		for i, item := range x {
+			n, err := normaliseDocument(item)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = n
+		}
+		return l, nil
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, item := range x {
+			n, err := normaliseDocument(item)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = n
+		}
+		return l, nil
+	}
+	return v, nil
+}
+
+// pipelineJSON converts the text of a pipeline in a format to JSON. JSON is returned as-is, so that syntax errors are
+// left to be reported by the caller with their location.
+func pipelineJSON(text []byte, format string) ([]byte, error) {
+	var (
+		v   interface{}
+		err error
+	)
+	switch format {
+	case FormatYAML:
+		err = yaml.Unmarshal(text, &v)
+	case FormatTOML:
+		var m map[string]interface{}
+		_, err = toml.Decode(string(text), &m)
+		v = m
+	default:
+		return text, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", format, err)
+	}
+	// An empty document is an empty pipeline.
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+	v, err = normaliseDocument(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", format, err)
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// plainDocument converts the numbers of a decoded JSON document to integers where possible, and floats otherwise, so
+// that they are encoded as numbers in other formats.
+func plainDocument(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range x {
+			x[k] = plainDocument(item)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = plainDocument(item)
+		}
+	}
+	return v
+}
+
+// ConvertPipeline converts a pipeline in JSON to another format.
+func ConvertPipeline(b []byte, format string) ([]byte, error) {
+	if err := ValidFormat(format); err != nil {
+		return nil, err
+	}
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(plainDocument(doc))
+	case FormatTOML:
+		if _, ok := doc.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("a pipeline must be an object to be converted to toml")
+		}
+		buff := new(bytes.Buffer)
+		err = toml.NewEncoder(buff).Encode(plainDocument(doc))
+		return buff.Bytes(), err
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// isJSON reports whether format is JSON, which is the default.
+func isJSON(format string) bool {
+	return len(format) == 0 || format == FormatJSON
+}
@@ -0,0 +1,222 @@
+package boogie
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// evaluationTable arranges evaluation results into sorted topics and measures.
+// Any aggregate rows (see AggregateEvaluations) are placed after the topics.
+func evaluationTable(evaluationResults map[string]map[string]float64) (topics, measures []string) {
+	seen := make(map[string]bool)
+	for topic, results := range evaluationResults {
+		if !isAggregateTopic(topic) {
+			topics = append(topics, topic)
+		}
+		for measure := range results {
+			if !seen[measure] {
+				seen[measure] = true
+				measures = append(measures, measure)
+			}
+		}
+	}
+	sortTopics(topics)
+	sort.Strings(measures)
+	for _, topic := range aggregateTopics {
+		if _, ok := evaluationResults[topic]; ok {
+			topics = append(topics, topic)
+		}
+	}
+	return
+}
+
+// evaluationMeans computes the mean of each measure over all topics, excluding aggregate rows.
+func evaluationMeans(evaluationResults map[string]map[string]float64, topics, measures []string) map[string]float64 {
+	means := make(map[string]float64)
+	for _, measure := range measures {
+		var v []float64
+		for _, topic := range topics {
+			if !isAggregateTopic(topic) {
+				v = append(v, evaluationResults[topic][measure])
+			}
+		}
+		means[measure] = mean(v)
+	}
+	return means
+}
+
+// JsonEvaluationFormatter formats evaluation results as a JSON object of topics to measures, with topics in the
+// configured order.
+func JsonEvaluationFormatter(evaluationResults map[string]map[string]float64) (string, error) {
+	topics, _ := evaluationTable(evaluationResults)
+	buff := new(bytes.Buffer)
+	buff.WriteString("{")
+	for i, topic := range topics {
+		if i > 0 {
+			buff.WriteString(",")
+		}
+		k, err := json.Marshal(topic)
+		if err != nil {
+			return "", err
+		}
+		// Measures are sorted when marshalled as a map.
+		v, err := json.MarshalIndent(evaluationResults[topic], "  ", "  ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(buff, "\n  %s: %s", k, v)
+	}
+	buff.WriteString("\n}\n")
+	return buff.String(), nil
+}
+
+// CsvEvaluationFormatter formats evaluation results as comma separated values, with a row per topic.
+func CsvEvaluationFormatter(evaluationResults map[string]map[string]float64) (string, error) {
+	topics, measures := evaluationTable(evaluationResults)
+	buff := new(bytes.Buffer)
+	w := csv.NewWriter(buff)
+	err := w.Write(append([]string{"topic"}, measures...))
+	if err != nil {
+		return "", err
+	}
+	for _, topic := range topics {
+		row := []string{topic}
+		for _, measure := range measures {
+			row = append(row, strconv.FormatFloat(evaluationResults[topic][measure], 'f', -1, 64))
+		}
+		err = w.Write(row)
+		if err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buff.String(), w.Error()
+}
+
+// TrecEvalEvaluationFormatter formats evaluation results in the same way as trec_eval -q; a line of measure, topic,
+// and value for each topic, followed by the mean of each measure for the topic `all`.
+func TrecEvalEvaluationFormatter(evaluationResults map[string]map[string]float64) (string, error) {
+	topics, measures := evaluationTable(evaluationResults)
+	means := evaluationMeans(evaluationResults, topics, measures)
+	buff := new(bytes.Buffer)
+	for _, measure := range measures {
+		for _, topic := range topics {
+			if v, ok := evaluationResults[topic][measure]; ok {
+				fmt.Fprintf(buff, "%-22s\t%s\t%.4f\n", measure, topic, v)
+			}
+		}
+		fmt.Fprintf(buff, "%-22s\t%s\t%.4f\n", measure, "all", means[measure])
+	}
+	return buff.String(), nil
+}
+
+// LatexEvaluationFormatter formats evaluation results as a LaTeX table, with a row per topic and a final row for
+// the mean of each measure.
+func LatexEvaluationFormatter(evaluationResults map[string]map[string]float64) (string, error) {
+	topics, measures := evaluationTable(evaluationResults)
+	means := evaluationMeans(evaluationResults, topics, measures)
+	escape := strings.NewReplacer("_", `\_`, "&", `\&`, "%", `\%`, "#", `\#`)
+
+	buff := new(bytes.Buffer)
+	fmt.Fprintf(buff, "\\begin{tabular}{l%s}\n\\toprule\n", strings.Repeat("r", len(measures)))
+	header := []string{"Topic"}
+	for _, measure := range measures {
+		header = append(header, escape.Replace(measure))
+	}
+	fmt.Fprintf(buff, "%s \\\\\n\\midrule\n", strings.Join(header, " & "))
+	for _, topic := range topics {
+		row := []string{escape.Replace(topic)}
+		for _, measure := range measures {
+			row = append(row, fmt.Sprintf("%.4f", evaluationResults[topic][measure]))
+		}
+		fmt.Fprintf(buff, "%s \\\\\n", strings.Join(row, " & "))
+	}
+	// The mean is already a row if the evaluations have been aggregated.
+	if _, ok := evaluationResults[AggregateMean]; !ok {
+		row := []string{"Mean"}
+		for _, measure := range measures {
+			row = append(row, fmt.Sprintf("%.4f", means[measure]))
+		}
+		fmt.Fprintf(buff, "\\midrule\n%s \\\\\n", strings.Join(row, " & "))
+	}
+	fmt.Fprint(buff, "\\bottomrule\n\\end{tabular}\n")
+	return buff.String(), nil
+}
+
+// MarkdownEvaluationFormatter formats evaluation results as a Markdown table, with a row per topic and a final row
+// for the mean of each measure.
+func MarkdownEvaluationFormatter(evaluationResults map[string]map[string]float64) (string, error) {
+	topics, measures := evaluationTable(evaluationResults)
+	means := evaluationMeans(evaluationResults, topics, measures)
+
+	buff := new(bytes.Buffer)
+	fmt.Fprintf(buff, "| Topic | %s |\n", strings.Join(measures, " | "))
+	fmt.Fprintf(buff, "|---|%s\n", strings.Repeat("---:|", len(measures)))
+	for _, topic := range topics {
+		row := []string{topic}
+		for _, measure := range measures {
+			row = append(row, fmt.Sprintf("%.4f", evaluationResults[topic][measure]))
+		}
+		fmt.Fprintf(buff, "| %s |\n", strings.Join(row, " | "))
+	}
+	// The mean is already a row if the evaluations have been aggregated.
+	if _, ok := evaluationResults[AggregateMean]; !ok {
+		row := []string{"**Mean**"}
+		for _, measure := range measures {
+			row = append(row, fmt.Sprintf("%.4f", means[measure]))
+		}
+		fmt.Fprintf(buff, "| %s |\n", strings.Join(row, " | "))
+	}
+	return buff.String(), nil
+}
+
+// LabelledMeasurementFormatter formats measurements along with a label for each topic (e.g. for learning to rank).
+type LabelledMeasurementFormatter func(topics []string, headers []string, data [][]float64, labels []float64) (string, error)
+
+// TsvMeasurementFormatter formats measurements as tab separated values, with a row per topic.
+func TsvMeasurementFormatter(topics []string, headers []string, data [][]float64) (string, error) {
+	buff := new(bytes.Buffer)
+	fmt.Fprintf(buff, "topic\t%s\n", strings.Join(headers, "\t"))
+	for j, topic := range topics {
+		row := []string{topic}
+		for i := range headers {
+			row = append(row, strconv.FormatFloat(data[i][j], 'f', -1, 64))
+		}
+		fmt.Fprintln(buff, strings.Join(row, "\t"))
+	}
+	return buff.String(), nil
+}
+
+// features formats the measurements of a topic as numbered features, as in LibSVM and RankLib files.
+func features(j int, data [][]float64) string {
+	f := make([]string, len(data))
+	for i := range data {
+		f[i] = fmt.Sprintf("%d:%s", i+1, strconv.FormatFloat(data[i][j], 'f', -1, 64))
+	}
+	return strings.Join(f, " ")
+}
+
+// LibSVMMeasurementFormatter formats measurements as a LibSVM feature file, with a line per topic.
+// Features are numbered in the order of the headers, and the topic is added as a comment.
+func LibSVMMeasurementFormatter(topics []string, headers []string, data [][]float64, labels []float64) (string, error) {
+	buff := new(bytes.Buffer)
+	for j, topic := range topics {
+		fmt.Fprintf(buff, "%s %s # %s\n", strconv.FormatFloat(labels[j], 'f', -1, 64), features(j, data), topic)
+	}
+	return buff.String(), nil
+}
+
+// RankLibMeasurementFormatter formats measurements as a RankLib (and SVMrank) feature file, with a line per topic.
+// Features are numbered in the order of the headers, and the topic is used as the qid.
+func RankLibMeasurementFormatter(topics []string, headers []string, data [][]float64, labels []float64) (string, error) {
+	buff := new(bytes.Buffer)
+	for j, topic := range topics {
+		fmt.Fprintf(buff, "%s qid:%s %s # %s\n", strconv.FormatFloat(labels[j], 'f', -1, 64), topic, features(j, data), topic)
+	}
+	return buff.String(), nil
+}
@@ -0,0 +1,110 @@
+package boogie
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLabelledMeasurementFormatters(t *testing.T) {
+	topics := []string{"1", "2"}
+	headers := []string{"term_count", "avg_idf"}
+	data := [][]float64{{2, 3}, {0.5, 1.25}}
+	labels := []float64{1, 0}
+	tests := []struct {
+		name      string
+		formatter LabelledMeasurementFormatter
+		want      string
+	}{
+		{"libsvm", LibSVMMeasurementFormatter, "1 1:2 2:0.5 # 1\n0 1:3 2:1.25 # 2\n"},
+		{"ranklib", RankLibMeasurementFormatter, "1 qid:1 1:2 2:0.5 # 1\n0 qid:2 1:3 2:1.25 # 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.formatter(topics, headers, data, labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunLibSVM(t *testing.T) {
+	dsl, dir, cleanup := newTestPipeline(t, map[string]string{"1": "heart attack", "2": "winter"})
+	defer cleanup()
+	qrels := filepath.Join(dir, "qrels")
+	err := ioutil.WriteFile(qrels, []byte("1 0 1 1\n1 0 4 1\n2 0 4 1\n2 0 3 0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The labelled formatter is the only output of the pipeline.
+	features := filepath.Join(dir, "features.svm")
+	dsl.Measurements = []string{"term_count"}
+	dsl.Output = PipelineOutput{
+		Measurements: []MeasurementOutput{{Format: "libsvm", Filename: features, Label: "qrels"}},
+		Evaluations:  EvaluationOutput{Qrels: qrels},
+	}
+
+	r, err := NewRun(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2 1:2 # 1\n1 1:1 # 2\n"; string(b) != want {
+		t.Errorf("features.svm = %q, want %q", b, want)
+	}
+}
+
+func TestTrecEvalEvaluationFormatter(t *testing.T) {
+	results := map[string]map[string]float64{
+		"10": {"P10": 0.5, "recall": 1},
+		"2":  {"P10": 0.25, "recall": 0.5},
+	}
+	got, err := TrecEvalEvaluationFormatter(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "P10                   \t2\t0.2500\n" +
+		"P10                   \t10\t0.5000\n" +
+		"P10                   \tall\t0.3750\n" +
+		"recall                \t2\t0.5000\n" +
+		"recall                \t10\t1.0000\n" +
+		"recall                \tall\t0.7500\n"
+	if got != want {
+		t.Errorf("trec_eval =\n%s\nwant\n%s", got, want)
+	}
+
+	// Aggregate rows follow the topics, and are not included in the mean.
+	for topic, v := range AggregateEvaluations(results) {
+		results[topic] = v
+	}
+	got, err = TrecEvalEvaluationFormatter(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "P10                   \t2\t0.2500\n" +
+		"P10                   \t10\t0.5000\n" +
+		"P10                   \tmean\t0.3750\n" +
+		"P10                   \tmedian\t0.3750\n" +
+		"P10                   \tstd\t0.1768\n" +
+		"P10                   \tall\t0.3750\n" +
+		"recall                \t2\t0.5000\n" +
+		"recall                \t10\t1.0000\n" +
+		"recall                \tmean\t0.7500\n" +
+		"recall                \tmedian\t0.7500\n" +
+		"recall                \tstd\t0.3536\n" +
+		"recall                \tall\t0.7500\n"
+	if got != want {
+		t.Errorf("aggregated trec_eval =\n%s\nwant\n%s", got, want)
+	}
+}
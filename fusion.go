@@ -0,0 +1,256 @@
+package boogie
+
+import (
+	"fmt"
+	"github.com/hscells/groove/combinator"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/merging"
+	"github.com/hscells/trecresults"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FusionSource is a statistic source used in rank fusion.
+type FusionSource struct {
+	Name   string
+	Source stats.StatisticsSource
+	// Output is where the run of this source is written to (optional).
+	Output *os.File
+	// Field is searched by the queries of this source in place of the fields of their keywords (optional).
+	Field string
+	// Reranker re-ranks the run of this source before it is merged (optional).
+	Reranker *Reranker
+	// cache caches the documents retrieved for the queries of this source.
+	cache combinator.QueryCacher
+}
+
+// Fusion fuses the runs of a topic retrieved from several statistics sources into a single run, using a merger.
+// The run of the first source is retrieved by groove, and the runs of the others once it has been.
+type Fusion struct {
+	Sources []FusionSource
+	Merger  merging.Merger
+	// runs are the trec results of each source by topic, which are written to the outputs of the sources by WriteRuns.
+	runs []map[string][]string
+	mu   sync.Mutex
+}
+
+// NewFusion creates a fusion of the runs of sources using merger.
+func NewFusion(merger merging.Merger, sources ...FusionSource) (*Fusion, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("at least one statistic source is required for rank fusion")
+	}
+	runs := make([]map[string][]string, len(sources))
+	for i := range runs {
+		runs[i] = make(map[string][]string)
+		if sources[i].cache == nil {
+			sources[i].cache = NewMapQueryCache()
+		}
+	}
+	return &Fusion{
+		Sources: sources,
+		Merger:  merger,
+		runs:    runs,
+	}, nil
+}
+
+// retrieve retrieves the run of a query from a source, as groove does.
+func (f *Fusion) retrieve(source FusionSource, query pipeline.Query) (trecresults.ResultList, error) {
+	if len(source.Field) > 0 {
+		query.Query = searchField(query.Query, source.Field)
+	}
+	tree, cache, err := combinator.NewLogicalTree(query, retrievalSource(source.Source), source.cache)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Documents(cache).Results(query, query.Name), nil
+}
+
+// fusionItems are the items of a run to be merged. A run that is not scored (i.e. that of a Boolean query) scores each
+// document it retrieves 1.
+func fusionItems(results trecresults.ResultList) merging.Items {
+	scored := false
+	for _, r := range results {
+		if r.Score != 0 {
+			scored = true
+			break
+		}
+	}
+	items := make(merging.Items, len(results))
+	for i, r := range results {
+		items[i] = merging.Item{Id: r.DocId, Score: r.Score}
+		if !scored {
+			items[i].Score = 1
+		}
+	}
+	return items
+}
+
+// Fuse retrieves the runs of a query from every source other than the first, whose run has already been retrieved,
+// re-ranks the run of each source that has a reranker, and merges them into a single run. Every document retrieved by
+// any source is kept.
+func (f *Fusion) Fuse(query pipeline.Query, first trecresults.ResultList) (trecresults.ResultList, error) {
+	lists := make([]merging.Items, len(f.Sources))
+	for i, source := range f.Sources {
+		results := first
+		var err error
+		if i > 0 {
+			results, err = f.retrieve(source, query)
+			if err != nil {
+				return nil, fmt.Errorf("statistic source %s: %v", source.Name, err)
+			}
+		}
+		if source.Reranker != nil {
+			results, err = source.Reranker.Rerank(query.Query, results)
+			if err != nil {
+				return nil, fmt.Errorf("statistic source %s: %v", source.Name, err)
+			}
+		}
+
+		// Keep the run of each individual source so it can be compared to the fused run. A topic that is fused again
+		// replaces its previous results.
+		if source.Output != nil {
+			l := make([]string, len(results))
+			for j, r := range results {
+				l[j] = r.String()
+			}
+			f.mu.Lock()
+			f.runs[i][query.Topic] = l
+			f.mu.Unlock()
+		}
+		lists[i] = fusionItems(results)
+	}
+
+	// Documents with the same score are ordered by their id, as mergers do not order them consistently.
+	fused := f.Merger.Merge(lists)
+	sort.Slice(fused, func(i, j int) bool {
+		if fused[i].Score != fused[j].Score {
+			return fused[i].Score > fused[j].Score
+		}
+		return naturalLess(fused[i].Id, fused[j].Id)
+	})
+
+	results := make(trecresults.ResultList, len(fused))
+	for i, item := range fused {
+		results[i] = &trecresults.Result{
+			Topic:     query.Topic,
+			Iteration: "Q0",
+			DocId:     item.Id,
+			Rank:      int64(i + 1),
+			Score:     item.Score,
+			RunName:   query.Name,
+		}
+	}
+	return results, nil
+}
+
+// WriteRuns writes the run of each individual source to its output, with topics in the configured order. Topics in
+// failed are not written.
+func (f *Fusion) WriteRuns(failed map[string]bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, source := range f.Sources {
+		if source.Output == nil {
+			continue
+		}
+		var topics []string
+		for topic := range f.runs[i] {
+			if !failed[topic] {
+				topics = append(topics, topic)
+			}
+		}
+		sortTopics(topics)
+		for _, topic := range topics {
+			if len(f.runs[i][topic]) == 0 {
+				continue
+			}
+			_, err := source.Output.WriteString(strings.Join(f.runs[i][topic], "\n") + "\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the run files of the individual sources.
+func (f *Fusion) Close() error {
+	var err error
+	for _, source := range f.Sources {
+		if source.Output != nil {
+			if e := source.Output.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// statisticSourceConfig extracts the source, name, and options of one of the `sources` in the statistic DSL.
+func statisticSourceConfig(config map[string]interface{}, i int) (source, name string, options map[string]interface{}, err error) {
+	source, ok := config["source"].(string)
+	if !ok {
+		return "", "", nil, fmt.Errorf("statistic source %d does not specify a source", i)
+	}
+	name = fmt.Sprintf("%s_%d", source, i)
+	if v, ok := config["name"]; ok {
+		if name, ok = v.(string); !ok {
+			return "", "", nil, fmt.Errorf("name of statistic source %d must be a string, got %v", i, v)
+		}
+	}
+	options = make(map[string]interface{})
+	if v, ok := config["options"]; ok {
+		if options, ok = v.(map[string]interface{}); !ok {
+			return "", "", nil, fmt.Errorf("options of statistic source %s must be an object", name)
+		}
+	}
+	return source, name, options, nil
+}
+
+// NewFusionFromDSL creates a fusion of the `sources` of the statistic DSL. Each source must have been registered prior
+// (see RegisterSources), and is cached individually if configured.
+func NewFusionFromDSL(dsl Pipeline) (*Fusion, error) {
+	merger, ok := mergers[dsl.Statistic.Merger]
+	if !ok {
+		return nil, fmt.Errorf("%v is not a known merger", dsl.Statistic.Merger)
+	}
+
+	sources := make([]FusionSource, len(dsl.Statistic.Sources))
+	for i, config := range dsl.Statistic.Sources {
+		source, name, options, err := statisticSourceConfig(config, i)
+		if err != nil {
+			return nil, err
+		}
+		ss, ok := statisticSourceMapping[name]
+		if !ok {
+			return nil, fmt.Errorf("%v is not a known statistics source", name)
+		}
+		ss, err = NewCachedStatisticsSourceFromDSL(ss, dsl.Cache, config)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = FusionSource{Name: name, Source: ss, cache: queryCacheMapping[name]}
+		search, err := NewElasticsearchSearch(source, options)
+		if err != nil {
+			return nil, err
+		}
+		sources[i].Field = search.Field
+		if search.Model != nil {
+			sources[i].Reranker = &Reranker{Source: ss, Scorer: search.Model}
+		}
+		if v, ok := config["output"]; ok {
+			output, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("output of statistic source %s must be a string, got %v", name, v)
+			}
+			sources[i].Output, err = os.OpenFile(output, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return NewFusion(merger, sources...)
+}
@@ -0,0 +1,167 @@
+package boogie
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/merging"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The collections of two sources, where document 3 is about a heart in one and an attack in the other.
+const (
+	testFusionCollectionA = `PMID- 1
+TI  - Heart attack.
+
+PMID- 2
+TI  - Heart failure.
+
+PMID- 3
+TI  - Panic attack.
+`
+	testFusionCollectionB = `PMID- 1
+TI  - Heart attack.
+
+PMID- 3
+TI  - Heart surgery.
+
+PMID- 4
+TI  - Heart attack in winter.
+`
+)
+
+func TestFusionFuse(t *testing.T) {
+	output, err := ioutil.TempFile("", "boogie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(output.Name())
+
+	f, err := NewFusion(merging.CombSUM{},
+		FusionSource{Name: "a", Source: newTestLocalSource(t, "boolean", testFusionCollectionA)},
+		FusionSource{Name: "b", Source: newTestLocalSource(t, "boolean", testFusionCollectionB), Output: output},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each source retrieves the documents that match both keywords in its own collection, so document 3 matches in
+	// neither.
+	q := pipeline.NewQuery("q1", "1", cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("heart", "text"),
+		cqr.NewKeyword("attack", "text"),
+	}))
+	first, err := f.retrieve(f.Sources[0], q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := f.Fuse(q, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var docs []string
+	var scores []float64
+	for i, r := range results {
+		docs = append(docs, r.DocId)
+		scores = append(scores, r.Score)
+		if r.Rank != int64(i+1) || r.Topic != "1" {
+			t.Errorf("result %d has rank %d and topic %s, want %d and 1", i, r.Rank, r.Topic, i+1)
+		}
+	}
+	if want := []string{"1", "4"}; !reflect.DeepEqual(docs, want) {
+		t.Errorf("Fuse() = %v, want %v", docs, want)
+	}
+	// Boolean runs are unscored, so each source scores the documents it retrieves 1.
+	if want := []float64{2, 1}; !reflect.DeepEqual(scores, want) {
+		t.Errorf("Fuse() scores = %v, want %v", scores, want)
+	}
+
+	err = f.WriteRuns(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestRun(t, output.Name())["1"]; !reflect.DeepEqual(got, []string{"1", "4"}) {
+		t.Errorf("run of source b = %v, want [1 4]", got)
+	}
+}
+
+func TestRunFusion(t *testing.T) {
+	dsl, dir, cleanup := newTestPipeline(t, map[string]string{"1": "heart", "2": "attack"})
+	defer cleanup()
+
+	var sources []map[string]interface{}
+	for _, name := range []string{"a", "b"} {
+		collection := filepath.Join(dir, name+".txt")
+		c := testFusionCollectionA
+		if name == "b" {
+			c = testFusionCollectionB
+		}
+		err := ioutil.WriteFile(collection, []byte(c), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, map[string]interface{}{
+			"source": "local",
+			"name":   name,
+			"options": map[string]interface{}{
+				"collection": collection,
+				"format":     CollectionMEDLINE,
+				"index":      filepath.Join(dir, name+".index"),
+			},
+			"output": filepath.Join(dir, name+".trec"),
+		})
+	}
+	dsl.Statistic = PipelineStatistic{Sources: sources, Merger: "combSUM"}
+
+	r, err := NewRun(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filename string
+		want     map[string][]string
+	}{
+		{"run.trec", map[string][]string{"1": {"1", "2", "3", "4"}, "2": {"1", "3", "4"}}},
+		{"a.trec", map[string][]string{"1": {"1", "2"}, "2": {"1", "3"}}},
+		{"b.trec", map[string][]string{"1": {"1", "3", "4"}, "2": {"1", "4"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got := readTestRun(t, filepath.Join(dir, tt.filename))
+			for topic, docs := range got {
+				sorted := append([]string(nil), docs...)
+				if tt.filename != "run.trec" {
+					// The order of the documents of a Boolean run is not specified.
+					sortTopics(sorted)
+				}
+				got[topic] = sorted
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.filename, got, tt.want)
+			}
+		})
+	}
+
+	// The topics of the fused run are written in order.
+	b, err := ioutil.ReadFile(filepath.Join(dir, "run.trec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "1 ") {
+		t.Errorf("run.trec starts with %q, want topic 1", strings.SplitN(string(b), "\n", 2)[0])
+	}
+}
@@ -3,6 +3,7 @@ module github.com/hscells/boogie
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/alexflint/go-arg v1.3.0
 	github.com/bramvdbogaerde/go-scp v0.0.0-20201229172121-7a6c0268fa67
 	github.com/go-errors/errors v1.1.1
@@ -21,6 +22,8 @@ require (
 	github.com/nsf/termbox-go v0.0.0-20210114135735-d04385b850e8
 	github.com/olivere/elastic/v7 v7.0.22
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	gopkg.in/olivere/elastic.v5 v5.0.86
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 replace github.com/hscells/groove => ../groove
@@ -0,0 +1,799 @@
+package boogie
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Formats of the document collections of the local source.
+const (
+	CollectionJSONL   = "jsonl"
+	CollectionTREC    = "trec"
+	CollectionMEDLINE = "medline"
+)
+
+// localDocument is a document of a collection, and the text of each of its fields.
+type localDocument struct {
+	id     string
+	fields map[string]string
+}
+
+// localPosting is the positions of a term in a document.
+type localPosting struct {
+	Doc       int
+	Positions []int
+}
+
+// localField is the inverted index of a field.
+type localField struct {
+	// Postings are the documents each term occurs in, in order of document.
+	Postings map[string][]localPosting
+	// Lengths are the number of terms in the field of each document.
+	Lengths []int
+	Terms   float64
+}
+
+// localIndex is an inverted index of the fields of a document collection.
+type localIndex struct {
+	Documents []string
+	Fields    map[string]*localField
+	// ids are the numbers of each document.
+	ids map[string]int
+}
+
+// LocalStatisticsSource is a statistics source backed by an inverted index on disk, built from a collection of
+// documents, so that experiments can be run without any external system. Queries are matched as Boolean queries
+// (supporting and, or, not, phrases, and truncation), and the documents retrieved are ranked using BM25.
+type LocalStatisticsSource struct {
+	index   *localIndex
+	field   string
+	model   string
+	params  map[string]float64
+	options stats.SearchOptions
+}
+
+var (
+	localIndexes   = make(map[string]*localIndex)
+	localIndexesMu sync.Mutex
+)
+
+// analyse splits text into lowercase terms.
+func analyse(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// readJSONLCollection reads a document from each line of a file, using idField as the id of each document. Every
+// string (or list of strings) in a document is a field.
+func readJSONLCollection(r io.Reader, idField string, fn func(localDocument) error) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		var v map[string]interface{}
+		err := json.Unmarshal(s.Bytes(), &v)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		d := localDocument{fields: make(map[string]string)}
+		for k, value := range v {
+			switch x := value.(type) {
+			case string:
+				d.fields[k] = x
+			case float64:
+				d.fields[k] = fmt.Sprint(x)
+			case []interface{}:
+				var values []string
+				for _, item := range x {
+					if s, ok := item.(string); ok {
+						values = append(values, s)
+					}
+				}
+				d.fields[k] = strings.Join(values, "\n")
+			}
+		}
+		d.id = d.fields[idField]
+		delete(d.fields, idField)
+		if len(d.id) == 0 {
+			return fmt.Errorf("line %d: the document has no %s", line, idField)
+		}
+		err = fn(d)
+		if err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// readTRECCollection reads the <DOC> elements of a TREC text file. The <DOCNO> of each document is its id, and every
+// other element is a field named after the element in lower case (e.g. <TEXT> is text).
+func readTRECCollection(r io.Reader, fn func(localDocument) error) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	var (
+		d       *localDocument
+		element string
+		text    []string
+	)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		for len(line) > 0 {
+			start := strings.Index(line, "<")
+			end := strings.Index(line, ">")
+			if start < 0 || end < start {
+				text = append(text, line)
+				break
+			}
+			if start > 0 {
+				text = append(text, line[:start])
+			}
+			tag := strings.ToLower(strings.Fields(line[start+1:end] + " ")[0])
+			line = strings.TrimSpace(line[end+1:])
+			switch {
+			case tag == "doc":
+				d = &localDocument{fields: make(map[string]string)}
+			case tag == "/doc":
+				if d == nil {
+					return fmt.Errorf("</DOC> without <DOC>")
+				}
+				if len(d.id) == 0 {
+					return fmt.Errorf("a document has no <DOCNO>")
+				}
+				err := fn(*d)
+				if err != nil {
+					return err
+				}
+				d = nil
+			case d == nil:
+			case len(element) == 0 && !strings.HasPrefix(tag, "/"):
+				element, text = tag, nil
+			case tag == "/"+element:
+				value := strings.TrimSpace(strings.Join(text, " "))
+				if element == "docno" {
+					d.id = value
+				} else if len(d.fields[element]) > 0 {
+					d.fields[element] += "\n" + value
+				} else {
+					d.fields[element] = value
+				}
+				element, text = "", nil
+			}
+		}
+	}
+	return s.Err()
+}
+
+// medlineFields are the fields of the tags of a MEDLINE record.
+var medlineFields = map[string]string{
+	"TI": "title",
+	"AB": "abstract",
+	"MH": "mesh_headings",
+	"PT": "publication_types",
+}
+
+// readMEDLINECollection reads the records of a MEDLINE file. The PMID of each record is its id, and the title (TI),
+// abstract (AB), MeSH headings (MH), and publication types (PT) are fields. The title and abstract are also the text
+// field.
+func readMEDLINECollection(r io.Reader, fn func(localDocument) error) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	d := localDocument{fields: make(map[string]string)}
+	tag := ""
+	emit := func() error {
+		if len(d.id) == 0 && len(d.fields) == 0 {
+			return nil
+		}
+		if len(d.id) == 0 {
+			return fmt.Errorf("a record has no PMID")
+		}
+		d.fields["text"] = strings.TrimSpace(d.fields["title"] + "\n" + d.fields["abstract"])
+		err := fn(d)
+		d = localDocument{fields: make(map[string]string)}
+		return err
+	}
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case len(strings.TrimSpace(line)) == 0:
+			err := emit()
+			if err != nil {
+				return err
+			}
+			tag = ""
+			continue
+		case strings.HasPrefix(line, "      "):
+			// A line that continues the value of the previous tag.
+		case len(line) >= 6 && line[4] == '-':
+			tag = strings.TrimSpace(line[:4])
+			if tag == "PMID" {
+				d.id = strings.TrimSpace(line[6:])
+				continue
+			}
+			if field, ok := medlineFields[tag]; ok && len(d.fields[field]) > 0 {
+				d.fields[field] += "\n"
+			}
+		default:
+			continue
+		}
+		if field, ok := medlineFields[tag]; ok {
+			d.fields[field] += strings.TrimSpace(line[6:]) + " "
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return emit()
+}
+
+// add indexes the fields of a document.
+func (ix *localIndex) add(d localDocument) error {
+	if _, ok := ix.ids[d.id]; ok {
+		return fmt.Errorf("the document %s occurs more than once", d.id)
+	}
+	doc := len(ix.Documents)
+	ix.Documents = append(ix.Documents, d.id)
+	ix.ids[d.id] = doc
+	for name, text := range d.fields {
+		f, ok := ix.Fields[name]
+		if !ok {
+			f = &localField{Postings: make(map[string][]localPosting)}
+			ix.Fields[name] = f
+		}
+		for len(f.Lengths) <= doc {
+			f.Lengths = append(f.Lengths, 0)
+		}
+		terms := analyse(text)
+		for i, term := range terms {
+			postings := f.Postings[term]
+			if len(postings) == 0 || postings[len(postings)-1].Doc != doc {
+				postings = append(postings, localPosting{Doc: doc})
+			}
+			postings[len(postings)-1].Positions = append(postings[len(postings)-1].Positions, i)
+			f.Postings[term] = postings
+		}
+		f.Lengths[doc] = len(terms)
+		f.Terms += float64(len(terms))
+	}
+	return nil
+}
+
+// remove removes a document from the index, given the text of its fields when it was added. The number of the
+// document is not reused until the index is compacted.
+func (ix *localIndex) remove(d localDocument) {
+	doc, ok := ix.ids[d.id]
+	if !ok {
+		return
+	}
+	delete(ix.ids, d.id)
+	for name, text := range d.fields {
+		f, ok := ix.Fields[name]
+		if !ok {
+			continue
+		}
+		for _, term := range analyse(text) {
+			postings := f.Postings[term]
+			i := sort.Search(len(postings), func(i int) bool {
+				return postings[i].Doc >= doc
+			})
+			if i == len(postings) || postings[i].Doc != doc {
+				continue
+			}
+			postings = append(postings[:i], postings[i+1:]...)
+			if len(postings) == 0 {
+				delete(f.Postings, term)
+			} else {
+				f.Postings[term] = postings
+			}
+		}
+		if doc < len(f.Lengths) {
+			f.Terms -= float64(f.Lengths[doc])
+			f.Lengths[doc] = 0
+		}
+	}
+}
+
+// compact renumbers the documents of the index so that removed documents no longer have a number, and every field has
+// the length of every document.
+func (ix *localIndex) compact() {
+	numbers := make([]int, len(ix.Documents))
+	documents := make([]string, 0, len(ix.ids))
+	for doc, id := range ix.Documents {
+		numbers[doc] = -1
+		if n, ok := ix.ids[id]; ok && n == doc {
+			numbers[doc] = len(documents)
+			documents = append(documents, id)
+		}
+	}
+	for _, f := range ix.Fields {
+		for _, postings := range f.Postings {
+			for i := range postings {
+				postings[i].Doc = numbers[postings[i].Doc]
+			}
+		}
+		lengths := make([]int, len(documents))
+		for doc, n := range f.Lengths {
+			if numbers[doc] >= 0 {
+				lengths[numbers[doc]] = n
+			}
+		}
+		f.Lengths = lengths
+	}
+	ix.Documents = documents
+	for doc, id := range documents {
+		ix.ids[id] = doc
+	}
+}
+
+// buildLocalIndex indexes a collection of documents in a format.
+func buildLocalIndex(collection, format, idField string) (*localIndex, error) {
+	f, err := os.Open(collection)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ix := &localIndex{Fields: make(map[string]*localField), ids: make(map[string]int)}
+	switch format {
+	case CollectionJSONL:
+		err = readJSONLCollection(f, idField, ix.add)
+	case CollectionTREC:
+		err = readTRECCollection(f, ix.add)
+	case CollectionMEDLINE:
+		err = readMEDLINECollection(f, ix.add)
+	default:
+		return nil, fmt.Errorf("%v is not a known collection format (expected one of: jsonl, trec, medline)", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", collection, err)
+	}
+	// Every field has a length for every document.
+	for _, field := range ix.Fields {
+		for len(field.Lengths) < len(ix.Documents) {
+			field.Lengths = append(field.Lengths, 0)
+		}
+	}
+	return ix, nil
+}
+
+// loadLocalIndex reads the index at path, building it from the collection first if it does not exist or the
+// collection has changed since. Indexes are only read once.
+func loadLocalIndex(path, collection, format, idField string) (*localIndex, error) {
+	localIndexesMu.Lock()
+	defer localIndexesMu.Unlock()
+	if ix, ok := localIndexes[path]; ok {
+		return ix, nil
+	}
+
+	build := len(collection) > 0
+	if info, err := os.Stat(path); err == nil && build {
+		c, err := os.Stat(collection)
+		if err != nil {
+			return nil, err
+		}
+		build = c.ModTime().After(info.ModTime())
+	} else if err != nil && !build {
+		return nil, err
+	}
+
+	var ix *localIndex
+	if build {
+		var err error
+		ix, err = buildLocalIndex(collection, format, idField)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		err = gob.NewEncoder(f).Encode(ix)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		ix = new(localIndex)
+		err = gob.NewDecoder(f).Decode(ix)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		ix.ids = make(map[string]int, len(ix.Documents))
+		for i, id := range ix.Documents {
+			ix.ids[id] = i
+		}
+	}
+	localIndexes[path] = ix
+	return ix, nil
+}
+
+// NewLocalStatisticsSource creates a statistics source from a local index.
+func NewLocalStatisticsSource(config map[string]interface{}) (*LocalStatisticsSource, error) {
+	var options LocalOptions
+	err := decodeOptions("local", config, &options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.Index) == 0 {
+		return nil, fmt.Errorf("the index of the local source must be specified")
+	}
+	format := CollectionJSONL
+	if len(options.Format) > 0 {
+		format = options.Format
+	}
+	idField := "id"
+	if len(options.IDField) > 0 {
+		idField = options.IDField
+	}
+
+	s := &LocalStatisticsSource{
+		field:  "text",
+		model:  ModelBM25,
+		params: map[string]float64{"k": 10, "lambda": 0.5},
+	}
+	if len(options.Field) > 0 {
+		s.field = options.Field
+	}
+	if len(options.Model) > 0 {
+		s.model = options.Model
+	}
+	if s.model != ModelBM25 && s.model != "boolean" {
+		return nil, fmt.Errorf("%v is not a known model of the local source (expected one of: bm25, boolean)", s.model)
+	}
+	if options.Params != nil {
+		s.params = options.Params
+	}
+
+	// The local source always retrieves 1000 documents for the run "run" unless otherwise specified.
+	search := options.Search
+	if search == nil {
+		search = &SearchOptions{}
+	}
+	s.options = search.searchOptions()
+
+	s.index, err = loadLocalIndex(options.Index, options.Collection, format, idField)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// fieldIndex is the index of a field.
+func (s *LocalStatisticsSource) fieldIndex(field string) (*localField, error) {
+	if len(field) == 0 {
+		field = s.field
+	}
+	f, ok := s.index.Fields[field]
+	if !ok {
+		return nil, fmt.Errorf("the local index has no field %s", field)
+	}
+	return f, nil
+}
+
+// occurrences finds the frequency of a term (or phrase) in each document of a field it occurs in. When truncated,
+// the last term of the phrase matches any term it is a prefix of.
+func (s *LocalStatisticsSource) occurrences(f *localField, term string, truncated bool) map[int]float64 {
+	if strings.HasSuffix(term, "*") {
+		term, truncated = strings.TrimSuffix(term, "*"), true
+	}
+	terms := analyse(term)
+	freq := make(map[int]float64)
+	if len(terms) == 0 {
+		return freq
+	}
+
+	last := []string{terms[len(terms)-1]}
+	if truncated {
+		last = nil
+		for t := range f.Postings {
+			if strings.HasPrefix(t, terms[len(terms)-1]) {
+				last = append(last, t)
+			}
+		}
+	}
+
+	// The positions of each term of the phrase in each document.
+	positions := func(term string) map[int]map[int]bool {
+		m := make(map[int]map[int]bool)
+		for _, p := range f.Postings[term] {
+			m[p.Doc] = make(map[int]bool, len(p.Positions))
+			for _, i := range p.Positions {
+				m[p.Doc][i] = true
+			}
+		}
+		return m
+	}
+	phrase := make([]map[int]map[int]bool, len(terms)-1)
+	for i, t := range terms[:len(terms)-1] {
+		phrase[i] = positions(t)
+	}
+
+	for _, l := range last {
+		for _, p := range f.Postings[l] {
+			for _, end := range p.Positions {
+				start := end - len(phrase)
+				match := start >= 0
+				for i := 0; match && i < len(phrase); i++ {
+					match = phrase[i][p.Doc][start+i]
+				}
+				if match {
+					freq[p.Doc]++
+				}
+			}
+		}
+	}
+	return freq
+}
+
+// keywordOccurrences finds the frequency of a keyword in each document, in any of its fields.
+func (s *LocalStatisticsSource) keywordOccurrences(k cqr.Keyword) (map[string]map[int]float64, error) {
+	fields := k.Fields
+	if len(fields) == 0 {
+		fields = []string{s.field}
+	}
+	truncated, _ := k.Options["truncated"].(bool)
+	m := make(map[string]map[int]float64, len(fields))
+	for _, field := range fields {
+		f, err := s.fieldIndex(field)
+		if err != nil {
+			return nil, err
+		}
+		m[field] = s.occurrences(f, k.QueryString, truncated)
+	}
+	return m, nil
+}
+
+// match finds the documents matching a Boolean query, and the keywords that contribute to its score.
+func (s *LocalStatisticsSource) match(query cqr.CommonQueryRepresentation, keywords *[]cqr.Keyword) (map[int]bool, error) {
+	docs := make(map[int]bool)
+	switch x := query.(type) {
+	case cqr.Keyword:
+		m, err := s.keywordOccurrences(x)
+		if err != nil {
+			return nil, err
+		}
+		for _, freq := range m {
+			for doc := range freq {
+				docs[doc] = true
+			}
+		}
+		if keywords != nil {
+			*keywords = append(*keywords, x)
+		}
+	case cqr.BooleanQuery:
+		operator := strings.ToLower(x.Operator)
+		if operator != cqr.AND && operator != cqr.OR && operator != cqr.NOT {
+			return nil, fmt.Errorf("the local source does not support the operator %s", x.Operator)
+		}
+		for i, child := range x.Children {
+			// Keywords that are prohibited do not contribute to the score.
+			k := keywords
+			if operator == cqr.NOT && i > 0 {
+				k = nil
+			}
+			c, err := s.match(child, k)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case i == 0 || operator == cqr.OR:
+				for doc := range c {
+					docs[doc] = true
+				}
+			case operator == cqr.AND:
+				for doc := range docs {
+					if !c[doc] {
+						delete(docs, doc)
+					}
+				}
+			case operator == cqr.NOT:
+				for doc := range c {
+					delete(docs, doc)
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("the local source does not support queries of type %T", query)
+	}
+	return docs, nil
+}
+
+// param is a parameter of the source, or its default.
+func (s *LocalStatisticsSource) param(name string, value float64) float64 {
+	if v, ok := s.params[name]; ok {
+		return v
+	}
+	return value
+}
+
+// score scores documents for the keywords of a query using BM25.
+func (s *LocalStatisticsSource) score(docs map[int]bool, keywords []cqr.Keyword) (map[int]float64, error) {
+	var (
+		scores = make(map[int]float64, len(docs))
+		N      = float64(len(s.index.Documents))
+		k1, b  = s.param("k1", 1.2), s.param("b", 0.75)
+	)
+	for _, k := range keywords {
+		m, err := s.keywordOccurrences(k)
+		if err != nil {
+			return nil, err
+		}
+		for field, freq := range m {
+			f := s.index.Fields[field]
+			avg := f.Terms / N
+			df := float64(len(freq))
+			idf := math.Log(1 + (N-df+0.5)/(df+0.5))
+			for doc, tf := range freq {
+				if docs[doc] {
+					scores[doc] += idf * (tf * (k1 + 1)) / (tf + k1*(1-b+b*float64(f.Lengths[doc])/avg))
+				}
+			}
+		}
+	}
+	return scores, nil
+}
+
+func (s *LocalStatisticsSource) SearchOptions() stats.SearchOptions {
+	return s.options
+}
+
+func (s *LocalStatisticsSource) Parameters() map[string]float64 {
+	return s.params
+}
+
+func (s *LocalStatisticsSource) TermFrequency(term, field, document string) (float64, error) {
+	f, err := s.fieldIndex(field)
+	if err != nil {
+		return 0, err
+	}
+	doc, ok := s.index.ids[document]
+	if !ok {
+		return 0, fmt.Errorf("the local index has no document %s", document)
+	}
+	return s.occurrences(f, term, false)[doc], nil
+}
+
+// TermVector finds the terms of every field of a document. As the index is inverted, this looks up the postings of
+// every term of the index.
+func (s *LocalStatisticsSource) TermVector(document string) (stats.TermVector, error) {
+	doc, ok := s.index.ids[document]
+	if !ok {
+		return nil, fmt.Errorf("the local index has no document %s", document)
+	}
+	var tv stats.TermVector
+	for name, f := range s.index.Fields {
+		for term, postings := range f.Postings {
+			i := sort.Search(len(postings), func(i int) bool {
+				return postings[i].Doc >= doc
+			})
+			if i == len(postings) || postings[i].Doc != doc {
+				continue
+			}
+			var ttf float64
+			for _, p := range postings {
+				ttf += float64(len(p.Positions))
+			}
+			tv = append(tv, stats.TermVectorTerm{
+				DocumentFrequency:  float64(len(postings)),
+				TotalTermFrequency: ttf,
+				TermFrequency:      float64(len(postings[i].Positions)),
+				Field:              name,
+				Term:               term,
+			})
+		}
+	}
+	sort.Slice(tv, func(i, j int) bool {
+		if tv[i].Field != tv[j].Field {
+			return tv[i].Field < tv[j].Field
+		}
+		return tv[i].Term < tv[j].Term
+	})
+	return tv, nil
+}
+
+func (s *LocalStatisticsSource) DocumentFrequency(term, field string) (float64, error) {
+	f, err := s.fieldIndex(field)
+	if err != nil {
+		return 0, err
+	}
+	return float64(len(s.occurrences(f, term, false))), nil
+}
+
+func (s *LocalStatisticsSource) TotalTermFrequency(term, field string) (float64, error) {
+	f, err := s.fieldIndex(field)
+	if err != nil {
+		return 0, err
+	}
+	var ttf float64
+	for _, tf := range s.occurrences(f, term, false) {
+		ttf += tf
+	}
+	return ttf, nil
+}
+
+func (s *LocalStatisticsSource) InverseDocumentFrequency(term, field string) (float64, error) {
+	df, err := s.DocumentFrequency(term, field)
+	if err != nil || df == 0 {
+		return 0, err
+	}
+	return math.Log(float64(len(s.index.Documents)) / df), nil
+}
+
+func (s *LocalStatisticsSource) VocabularySize(field string) (float64, error) {
+	f, err := s.fieldIndex(field)
+	if err != nil {
+		return 0, err
+	}
+	return float64(len(f.Postings)), nil
+}
+
+func (s *LocalStatisticsSource) CollectionSize() (float64, error) {
+	return float64(len(s.index.Documents)), nil
+}
+
+func (s *LocalStatisticsSource) RetrievalSize(query cqr.CommonQueryRepresentation) (float64, error) {
+	docs, err := s.match(query, nil)
+	return float64(len(docs)), err
+}
+
+func (s *LocalStatisticsSource) Execute(query pipeline.Query, options stats.SearchOptions) (trecresults.ResultList, error) {
+	var keywords []cqr.Keyword
+	docs, err := s.match(query.Query, &keywords)
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := make([]int, 0, len(docs))
+	for doc := range docs {
+		ranked = append(ranked, doc)
+	}
+	scores := make(map[int]float64)
+	if s.model == ModelBM25 {
+		scores, err = s.score(docs, keywords)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return s.index.Documents[ranked[i]] < s.index.Documents[ranked[j]]
+	})
+	if options.Size > 0 && len(ranked) > options.Size {
+		ranked = ranked[:options.Size]
+	}
+
+	results := make(trecresults.ResultList, len(ranked))
+	for i, doc := range ranked {
+		results[i] = &trecresults.Result{
+			Topic:     query.Topic,
+			Iteration: "Q0",
+			DocId:     s.index.Documents[doc],
+			Rank:      int64(i + 1),
+			Score:     scores[doc],
+			RunName:   options.RunName,
+		}
+	}
+	return results, nil
+}
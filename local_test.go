@@ -0,0 +1,141 @@
+package boogie
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestLocalSource creates a local source from a collection in the MEDLINE format.
+func newTestLocalSource(t *testing.T, model, collection string) *LocalStatisticsSource {
+	ix := &localIndex{Fields: make(map[string]*localField), ids: make(map[string]int)}
+	err := readMEDLINECollection(strings.NewReader(collection), ix.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range ix.Fields {
+		for len(field.Lengths) < len(ix.Documents) {
+			field.Lengths = append(field.Lengths, 0)
+		}
+	}
+	return &LocalStatisticsSource{index: ix, field: "text", model: model}
+}
+
+const testMEDLINECollection = `PMID- 1
+TI  - Heart attack in diabetic patients.
+AB  - Patients with diabetes had a heart attack.
+PT  - Randomized Controlled Trial
+
+PMID- 2
+TI  - Attack of the heart surgeons.
+PT  - Review
+
+PMID- 3
+TI  - Diabetes and the kidney.
+AB  - Kidney disease is common in diabetics.
+PT  - Review
+
+PMID- 4
+TI  - Heart failure.
+AB  - A study of heart
+      attack recovery.
+`
+
+func TestLocalStatisticsSourceMatch(t *testing.T) {
+	s := newTestLocalSource(t, "boolean", testMEDLINECollection)
+	keyword := func(q string, fields ...string) cqr.Keyword {
+		return cqr.NewKeyword(q, fields...)
+	}
+	tests := []struct {
+		name  string
+		query cqr.CommonQueryRepresentation
+		want  []string
+	}{
+		{"term", keyword("kidney"), []string{"3"}},
+		{"case", keyword("HEART"), []string{"1", "2", "4"}},
+		{"phrase", keyword("heart attack"), []string{"1", "4"}},
+		{"phrase across lines", keyword("heart attack recovery"), []string{"4"}},
+		{"phrase out of order", keyword("attack heart"), nil},
+		{"truncation", keyword("diabet*"), []string{"1", "3"}},
+		{"truncation option", keyword("diabet").SetOption("truncated", true), []string{"1", "3"}},
+		{"truncated phrase", keyword("heart att*"), []string{"1", "4"}},
+		{"field", keyword("review", "publication_types"), []string{"2", "3"}},
+		{"fields", keyword("diabetes", "title", "abstract"), []string{"1", "3"}},
+		{"and", cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{keyword("heart"), keyword("attack")}), []string{"1", "2", "4"}},
+		{"or", cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{keyword("kidney"), keyword("failure")}), []string{"3", "4"}},
+		{"not", cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{keyword("heart"), keyword("review", "publication_types")}), []string{"1", "4"}},
+		{"not several", cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{keyword("heart"), keyword("diabet*"), keyword("surgeons")}), []string{"4"}},
+		{"nested", cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+			keyword("diabet*"),
+			cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{
+				keyword("review", "publication_types"),
+				keyword("kidney"),
+			}),
+		}), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := s.Execute(pipeline.Query{Topic: "1", Query: test.query}, s.SearchOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, r.DocId)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			n, err := s.RetrievalSize(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(n) != len(test.want) {
+				t.Errorf("retrieval size %v, want %v", n, len(test.want))
+			}
+		})
+	}
+}
+
+func TestLocalStatisticsSourceErrors(t *testing.T) {
+	s := newTestLocalSource(t, "boolean", testMEDLINECollection)
+	tests := []struct {
+		name  string
+		query cqr.CommonQueryRepresentation
+	}{
+		{"unknown field", cqr.NewKeyword("heart", "journal")},
+		{"unknown operator", cqr.NewBooleanQuery("adj3", []cqr.CommonQueryRepresentation{cqr.NewKeyword("heart"), cqr.NewKeyword("attack")})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.Execute(pipeline.Query{Topic: "1", Query: test.query}, s.SearchOptions())
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLocalStatisticsSourceTermVector(t *testing.T) {
+	s := newTestLocalSource(t, "boolean", testMEDLINECollection)
+	tv, err := s.TermVector("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := make(map[string]float64)
+	for _, term := range tv {
+		if term.Field == "title" {
+			tf[term.Term] = term.TermFrequency
+		}
+	}
+	want := map[string]float64{"attack": 1, "of": 1, "the": 1, "heart": 1, "surgeons": 1}
+	if !reflect.DeepEqual(tf, want) {
+		t.Errorf("got %v, want %v", tf, want)
+	}
+	_, err = s.TermVector("5")
+	if err == nil {
+		t.Error("expected an error for a document that is not in the index")
+	}
+}
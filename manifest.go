@@ -0,0 +1,249 @@
+package boogie
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// Version is the version of boogie.
+const Version = "16.Jan.2019"
+
+// GrooveVersion is the version of the groove module boogie was built with, as groove does not declare one.
+func GrooveVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, m := range info.Deps {
+		if m.Path == "github.com/hscells/groove" {
+			if m.Replace != nil {
+				return m.Replace.Path
+			}
+			return m.Version
+		}
+	}
+	return "unknown"
+}
+
+// ManifestFile is a file read or written by a run, and the SHA-256 hash of its contents.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestArguments are the arguments the pipeline was templated with.
+type ManifestArguments struct {
+	Positional []string          `json:"positional"`
+	Named      map[string]string `json:"named"`
+}
+
+// ManifestVersions are the versions of boogie and groove used for a run.
+type ManifestVersions struct {
+	Boogie string `json:"boogie"`
+	Groove string `json:"groove"`
+}
+
+// Manifest records how the outputs of a run were produced, so that they can be reproduced.
+type Manifest struct {
+	// Pipeline is the fully resolved pipeline (after templates, extends, and include).
+	Pipeline  Pipeline          `json:"pipeline"`
+	Arguments ManifestArguments `json:"arguments"`
+	Versions  ManifestVersions  `json:"versions"`
+	Host      string            `json:"host"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	// Inputs are the query files, qrels, embeddings, collection, and replayed cassette read by the run.
+	Inputs []ManifestFile `json:"inputs"`
+	// Outputs are the files written by the run.
+	Outputs []ManifestFile `json:"outputs"`
+}
+
+// NewManifest starts the manifest of a run, hashing the inputs of the pipeline before they are used.
+func NewManifest(dsl Pipeline, ctx TemplateContext) (*Manifest, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := hashFiles(manifestInputs(dsl))
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{
+		Pipeline:  dsl,
+		Arguments: ManifestArguments{Positional: ctx.Args, Named: ctx.Values},
+		Versions:  ManifestVersions{Boogie: Version, Groove: GrooveVersion()},
+		Host:      host,
+		Start:     time.Now(),
+		Inputs:    inputs,
+	}, nil
+}
+
+// Write completes the manifest with the outputs of the run, and writes it to the `manifest` file of the output.
+func (m *Manifest) Write() error {
+	m.End = time.Now()
+	outputs, err := manifestOutputs(m.Pipeline)
+	if err != nil {
+		return err
+	}
+	m.Outputs, err = hashFiles(outputs)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ManifestFilename(m.Pipeline), b, 0644)
+}
+
+// ManifestFilename is where the manifest of a run is written; the `manifest` of the output, or manifest.json next to
+// the outputs of the pipeline.
+func ManifestFilename(dsl Pipeline) string {
+	if len(dsl.Output.Manifest) > 0 {
+		return dsl.Output.Manifest
+	}
+	if len(dsl.Sweep.Axes) > 0 {
+		return path.Join(dsl.Sweep.Output, "manifest.json")
+	}
+	for _, file := range pipelineOutputs(dsl) {
+		if !file.dir {
+			return path.Join(path.Dir(file.path), "manifest.json")
+		}
+	}
+	return "manifest.json"
+}
+
+// manifestInputs are the files read by a pipeline that determine its results.
+func manifestInputs(dsl Pipeline) []string {
+	var files []string
+	for _, file := range []string{
+		dsl.Query.Path,
+		dsl.Output.Evaluations.Qrels,
+		dsl.Output.Evaluations.Baseline,
+		dsl.Utilities.CUI2vec,
+		dsl.Utilities.CUIMapping,
+		dsl.Formulation.Options["entity_expander.cui2vec_precomputed_embeddings"],
+		dsl.Formulation.Options["keyword_mapper.mapper.cui2vec_frequent_mapping"],
+		dsl.Formulation.Options["keyword_mapper.mapper.cui2vec_alias_mapping"],
+	} {
+		if len(file) > 0 {
+			files = append(files, file)
+		}
+	}
+	if collection, ok := dsl.Statistic.Options["collection"].(string); ok && dsl.Statistic.Source == "local" {
+		files = append(files, collection)
+	}
+	if dsl.Cassette.Mode == CassetteReplay {
+		files = append(files, dsl.Cassette.Path)
+	}
+	return files
+}
+
+type outputFile struct {
+	path string
+	dir  bool
+}
+
+// pipelineOutputs are the files and directories written by a pipeline.
+func pipelineOutputs(dsl Pipeline) []outputFile {
+	var files []outputFile
+	add := func(p string, dir bool) {
+		if len(p) > 0 {
+			files = append(files, outputFile{path: p, dir: dir})
+		}
+	}
+	for _, formatter := range dsl.Output.Evaluations.Measurements {
+		add(formatter.Filename, false)
+	}
+	for _, formatter := range dsl.Output.Measurements {
+		add(formatter.Filename, false)
+	}
+	add(dsl.Output.Trec.Output, false)
+	add(dsl.Output.Evaluations.Significance, false)
+	add(dsl.Output.Errors, false)
+	for _, source := range dsl.Statistic.Sources {
+		if output, ok := source["output"].(string); ok {
+			add(output, false)
+		}
+	}
+	add(dsl.Transformations.Output, true)
+	add(dsl.Formulation.Method, true)
+	return files
+}
+
+// manifestOutputs are the files written by a run that exist, including those of every configuration of a sweep.
+func manifestOutputs(dsl Pipeline) ([]string, error) {
+	outputs := pipelineOutputs(dsl)
+	if len(dsl.Sweep.Axes) > 0 {
+		configurations, err := ExpandSweep(dsl)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range configurations {
+			outputs = append(outputs, pipelineOutputs(c.Pipeline)...)
+		}
+		if len(dsl.Sweep.Summary) > 0 {
+			outputs = append(outputs, outputFile{path: dsl.Sweep.Summary})
+		}
+	}
+	var files []string
+	for _, output := range outputs {
+		if _, err := os.Stat(output.path); err == nil {
+			files = append(files, output.path)
+		}
+	}
+	return files, nil
+}
+
+// hashFiles hashes each file, and each file inside a directory.
+func hashFiles(paths []string) ([]ManifestFile, error) {
+	seen := make(map[string]bool)
+	var files []ManifestFile
+	for _, p := range paths {
+		err := filepath.Walk(p, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || seen[file] {
+				return nil
+			}
+			seen[file] = true
+			h, err := hashFile(file)
+			if err != nil {
+				return err
+			}
+			files = append(files, ManifestFile{Path: file, SHA256: h})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -11,7 +11,6 @@ import (
 	"github.com/hscells/groove/output"
 	"github.com/hscells/groove/preprocess"
 	"github.com/hscells/groove/query"
-	"github.com/hscells/groove/rank"
 	"github.com/hscells/groove/stats"
 	"github.com/hscells/merging"
 	"github.com/hscells/quickumlsrest"
@@ -31,15 +30,17 @@ var (
 	transformationMappingElasticsearch = map[string]preprocess.ElasticsearchTransformation{}
 	measurementMapping                 = map[string]analysis.Measurement{}
 	measurementFormatters              = map[string]output.MeasurementFormatter{}
+	labelledMeasurementFormatters      = map[string]LabelledMeasurementFormatter{}
 	evaluationMapping                  = map[string]eval.Evaluator{}
 	evaluationFormatters               = map[string]output.EvaluationFormatter{}
 	rewriteTransformationMapping       = map[string]learning.Transformation{}
 	modelMapping                       = map[string]learning.Model{}
-	scorers                            = map[string]rank.Scorer{}
+	scorers                            = map[string]Scorer{}
 	mergers                            = map[string]merging.Merger{}
+	queryCacheMapping                  = map[string]combinator.QueryCacher{}
 )
 
-func RegisterScorer(name string, scorer rank.Scorer) {
+func RegisterScorer(name string, scorer Scorer) {
 	scorers[name] = scorer
 }
 
@@ -47,6 +48,11 @@ func RegisterMerger(name string, merger merging.Merger) {
 	mergers[name] = merger
 }
 
+// RegisterQueryCache registers the query cache of the documents retrieved by a statistic source.
+func RegisterQueryCache(source string, cache combinator.QueryCacher) {
+	queryCacheMapping[source] = cache
+}
+
 // RegisterQuerySource registers a query source.
 func RegisterQuerySource(name string, source query.QueriesSource) {
 	querySourceMapping[name] = source
@@ -82,6 +88,11 @@ func RegisterMeasurementFormatter(name string, formatter output.MeasurementForma
 	measurementFormatters[name] = formatter
 }
 
+// RegisterLabelledMeasurementFormatter registers an output formatter that requires a label for each topic.
+func RegisterLabelledMeasurementFormatter(name string, formatter LabelledMeasurementFormatter) {
+	labelledMeasurementFormatters[name] = formatter
+}
+
 // RegisterEvaluator registers a measurement.
 func RegisterEvaluator(name string, evaluator eval.Evaluator) {
 	evaluationMapping[name] = evaluator
@@ -164,8 +175,11 @@ func NewOracleQueryChainCandidateSelector(source string, qrels string) learning.
 	}
 
 	if ss, ok := statisticSourceMapping[source]; ok {
-		// TODO the cache should be able to be configured.
-		return learning.NewOracleQueryChainCandidateSelector(ss, q, combinator.NewMapQueryCache())
+		cache, ok := queryCacheMapping[source]
+		if !ok {
+			cache = NewMapQueryCache()
+		}
+		return learning.NewOracleQueryChainCandidateSelector(ss, q, cache)
 	}
 
 	log.Fatal("could not create oracle query chain candidate selector")
@@ -173,131 +187,113 @@ func NewOracleQueryChainCandidateSelector(source string, qrels string) learning.
 }
 
 // NewKeywordQuerySource creates a "keyword query" query source.
-func NewKeywordQuerySource(options map[string]interface{}) query.QueriesSource {
+func NewKeywordQuerySource(options KeywordQueryOptions) query.QueriesSource {
 	fields := []string{"text"}
-	if optionFields, ok := options["fields"].([]interface{}); ok {
-		fields = make([]string, len(optionFields))
-		for i, f := range optionFields {
-			fields[i] = f.(string)
-		}
+	if len(options.Fields) > 0 {
+		fields = options.Fields
 	}
 
 	return query.NewKeywordQuerySource(fields...)
 }
 
 // NewTransmuteQuerySource creates a new transmute query source for PubMed/Medline queries.
-func NewTransmuteQuerySource(p pipeline.TransmutePipeline, options map[string]interface{}) query.QueriesSource {
-	if _, ok := options["mapping"]; ok {
-		if mapping, ok := options["mapping"].(map[string][]string); ok {
-			p.Options.FieldMapping = mapping
-		}
+func NewTransmuteQuerySource(p pipeline.TransmutePipeline, options TransmuteQueryOptions) query.QueriesSource {
+	if options.Mapping != nil {
+		p.Options.FieldMapping = options.Mapping
 	}
 
 	return query.NewTransmuteQuerySource(p)
 }
 
+// NewStatisticsSource creates one of the built-in statistics sources from a configuration mapping.
+// If the source is not built-in, nil is returned, as it may have been registered by other means.
+func NewStatisticsSource(source string, config map[string]interface{}) (stats.StatisticsSource, error) {
+	switch source {
+	case "elasticsearch":
+		return NewElasticsearchStatisticsSource(config)
+	case "terrier":
+		return newTerrierStatisticsSource(config)
+	case "entrez":
+		return NewEntrezStatisticsSource(config)
+	case "local":
+		return NewLocalStatisticsSource(config)
+	case "pubmed_baseline":
+		return NewPubMedBaselineStatisticsSource(config)
+	}
+	return nil, nil
+}
+
 // NewElasticsearchStatisticsSource attempts to create an Elasticsearch statistics source from a configuration mapping.
 // It also tries to set some defaults for fields in case some are not specified, but they will not be sensible.
 func NewElasticsearchStatisticsSource(config map[string]interface{}) (*stats.ElasticsearchStatisticsSource, error) {
-	var esHosts []string
-	documentType := "doc"
-	index := "index"
-	scroll := false
-
-	if hosts, ok := config["hosts"]; ok {
-		for _, host := range hosts.([]interface{}) {
-			esHosts = append(esHosts, host.(string))
-		}
-	} else {
-		esHosts = []string{"http://localhost:9200"}
-	}
-
-	var searchOptions stats.SearchOptions
-	if search, ok := config["search"].(map[string]interface{}); ok {
-		if size, ok := search["size"].(float64); ok {
-			searchOptions.Size = int(size)
-		} else {
-			searchOptions.Size = 1000
-		}
-
-		if runName, ok := search["run_name"].(string); ok {
-			searchOptions.RunName = runName
-		} else {
-			searchOptions.RunName = "run"
-		}
+	var options ElasticsearchOptions
+	err := decodeOptions("elasticsearch", config, &options)
+	if err != nil {
+		return nil, err
 	}
-
-	params := map[string]float64{"k": 10, "lambda": 0.5}
-	if p, ok := config["params"].(map[string]float64); ok {
-		params = p
+	client, err := newElasticsearchHTTPClient(options)
+	if err != nil {
+		return nil, err
 	}
-
-	if d, ok := config["document_type"]; ok {
-		documentType = d.(string)
+	esClient, err := newElasticsearchClient(options.hosts(), client)
+	if err != nil {
+		return nil, err
 	}
 
-	if i, ok := config["index"]; ok {
-		index = i.(string)
+	params := map[string]float64{"k": 10, "lambda": 0.5}
+	if options.Params != nil {
+		params = options.Params
 	}
 
-	if s, ok := config["scroll"]; ok {
-		scroll = s.(bool)
+	documentType := "doc"
+	if len(options.DocumentType) > 0 {
+		documentType = options.DocumentType
 	}
 
-	return stats.NewElasticsearchStatisticsSource(
+	esOptions := []func(source *stats.ElasticsearchStatisticsSource){
 		stats.ElasticsearchDocumentType(documentType),
-		stats.ElasticsearchIndex(index),
-		stats.ElasticsearchHosts(esHosts...),
+		stats.ElasticsearchIndex(options.index()),
+		elasticsearchClient(esClient),
 		stats.ElasticsearchParameters(params),
-		stats.ElasticsearchSearchOptions(searchOptions),
-		stats.ElasticsearchScroll(scroll))
+		stats.ElasticsearchSearchOptions(options.Search.searchOptions()),
+		stats.ElasticsearchScroll(options.Scroll),
+	}
+	if len(options.Analyser) > 0 {
+		esOptions = append(esOptions, stats.ElasticsearchAnalyser(options.Analyser))
+	}
+	if len(options.AnalyseField) > 0 {
+		esOptions = append(esOptions, stats.ElasticsearchAnalysedField(options.AnalyseField))
+	}
+	return stats.NewElasticsearchStatisticsSource(esOptions...)
 }
 
+// NewEntrezStatisticsSource creates an Entrez statistics source from a configuration mapping, with any additional
+// options applied afterwards.
 func NewEntrezStatisticsSource(config map[string]interface{}, options ...func(source *stats.EntrezStatisticsSource)) (stats.EntrezStatisticsSource, error) {
-	var (
-		tool, email, key string
-		rank             = false
-	)
-
-	if d, ok := config["tool"]; ok {
-		tool = d.(string)
+	var o EntrezOptions
+	err := decodeOptions("entrez", config, &o)
+	if err != nil {
+		return stats.EntrezStatisticsSource{}, err
 	}
 
-	if d, ok := config["email"]; ok {
-		email = d.(string)
+	err = configureEntrez(o)
+	if err != nil {
+		return stats.EntrezStatisticsSource{}, err
 	}
 
-	if d, ok := config["key"]; ok {
-		key = d.(string)
+	entrezOptions := []func(source *stats.EntrezStatisticsSource){
+		stats.EntrezAPIKey(o.Key),
+		stats.EntrezEmail(o.Email),
+		stats.EntrezTool(o.Tool),
+		stats.EntrezOptions(o.Search.searchOptions()),
+		stats.EntrezRank(o.Rank),
 	}
-
-	if d, ok := config["rank"]; ok {
-		rank = d.(bool)
+	if len(o.DB) > 0 {
+		entrezOptions = append(entrezOptions, stats.EntrezDb(o.DB))
 	}
-
-	var searchOptions stats.SearchOptions
-	if search, ok := config["search"].(map[string]interface{}); ok {
-		if size, ok := search["size"].(float64); ok {
-			searchOptions.Size = int(size)
-		} else {
-			searchOptions.Size = 1000
-		}
-
-		if runName, ok := search["run_name"].(string); ok {
-			searchOptions.RunName = runName
-		} else {
-			searchOptions.RunName = "run"
-		}
-	}
-
-	e, err := stats.NewEntrezStatisticsSource(
-		stats.EntrezAPIKey(key),
-		stats.EntrezEmail(email),
-		stats.EntrezTool(tool),
-		stats.EntrezOptions(searchOptions),
-		stats.EntrezRank(rank))
+	e, err := stats.NewEntrezStatisticsSource(entrezOptions...)
 	if err != nil {
-		return e, nil
+		return e, err
 	}
 
 	for _, option := range options {
@@ -4,38 +4,31 @@ package boogie
 
 import "github.com/hscells/groove/stats"
 
-// NewTerrierStatisticsSource attempts to create a terrier statistics source.
-func NewTerrierStatisticsSource(config map[string]interface{}) *stats.TerrierStatisticsSource {
-	var propsFile string
-	field := "text"
-
-	if pf, ok := config["properties"]; ok {
-		propsFile = pf.(string)
+// newTerrierStatisticsSource uses Terrier natively, unless the url of a Terrier REST bridge is configured.
+func newTerrierStatisticsSource(config map[string]interface{}) (stats.StatisticsSource, error) {
+	if _, ok := config["url"]; ok {
+		return NewTerrierRESTStatisticsSource(config)
 	}
+	return NewTerrierStatisticsSource(config)
+}
 
-	if f, ok := config["field"]; ok {
-		field = f.(string)
+// NewTerrierStatisticsSource attempts to create a terrier statistics source.
+func NewTerrierStatisticsSource(config map[string]interface{}) (*stats.TerrierStatisticsSource, error) {
+	var options TerrierOptions
+	err := decodeOptions("terrier", config, &options)
+	if err != nil {
+		return nil, err
 	}
 
-	var searchOptions stats.SearchOptions
-	if search, ok := config["search"].(map[string]interface{}); ok {
-		if size, ok := search["size"].(int); ok {
-			searchOptions.Size = size
-		} else {
-			searchOptions.Size = 1000
-		}
-
-		if runName, ok := search["run_name"].(string); ok {
-			searchOptions.RunName = runName
-		} else {
-			searchOptions.RunName = "run"
-		}
+	field := "text"
+	if len(options.Field) > 0 {
+		field = options.Field
 	}
 
 	params := map[string]float64{"k": 10, "lambda": 0.5}
-	if p, ok := config["params"].(map[string]float64); ok {
-		params = p
+	if options.Params != nil {
+		params = options.Params
 	}
 
-	return stats.NewTerrierStatisticsSource(stats.TerrierParameters(params), stats.TerrierField(field), stats.TerrierPropertiesPath(propsFile), stats.TerrierSearchOptions(searchOptions))
+	return stats.NewTerrierStatisticsSource(stats.TerrierParameters(params), stats.TerrierField(field), stats.TerrierPropertiesPath(options.Properties), stats.TerrierSearchOptions(options.Search.searchOptions())), nil
 }
@@ -0,0 +1,10 @@
+//+build !windows
+
+package boogie
+
+import "github.com/hscells/groove/stats"
+
+// newTerrierStatisticsSource uses a Terrier REST bridge, as Terrier can only be used natively on Windows.
+func newTerrierStatisticsSource(config map[string]interface{}) (stats.StatisticsSource, error) {
+	return NewTerrierRESTStatisticsSource(config)
+}
@@ -0,0 +1,60 @@
+package boogie
+
+import (
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/guru"
+	"github.com/hscells/transmute/fields"
+	"strconv"
+)
+
+// MedGenEntityExpander expands entities with the names of the MedGen concepts they match. Names from MeSH are
+// expanded as exploded MeSH headings, and all others as title and abstract keywords.
+type MedGenEntityExpander struct {
+	e stats.EntrezStatisticsSource
+}
+
+// NewMedGenEntityExpander creates an entity expander that searches the medgen database with an Entrez source.
+func NewMedGenEntityExpander(e stats.EntrezStatisticsSource) MedGenEntityExpander {
+	return MedGenEntityExpander{e: e.SetDB("medgen")}
+}
+
+// Expand expands a keyword with up to three names of each concept it matches, until more than five names are found.
+func (m MedGenEntityExpander) Expand(q cqr.Keyword) ([]cqr.CommonQueryRepresentation, error) {
+	ids, err := m.e.Search(q.QueryString)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	sids := make([]string, len(ids))
+	for i, id := range ids {
+		sids[i] = strconv.Itoa(id)
+	}
+	var summary guru.CeSummaryResult
+	err = m.e.Summary(sids, &summary)
+	if err != nil {
+		return nil, err
+	}
+
+	var keywords []cqr.CommonQueryRepresentation
+	for _, docSum := range summary.CDocumentSummarySet.CDocumentSummary {
+		for j, name := range docSum.CConceptMeta.CNames.CName {
+			if j > 2 {
+				break
+			}
+			query := cqr.NewKeyword(name.Value, fields.TitleAbstract)
+			if name.AttrSAB == "MSH" {
+				query.Fields = []string{fields.MeshHeadings}
+				query = query.SetOption(cqr.ExplodedString, true).(cqr.Keyword)
+			}
+			keywords = append(keywords, query)
+		}
+		if len(keywords) > 5 {
+			break
+		}
+	}
+	return keywords, nil
+}
@@ -0,0 +1,231 @@
+package boogie
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorPolicy determines what happens when an error occurs in a topic, configured by `on_error`.
+type ErrorPolicy struct {
+	// Abort stops the run at the first error.
+	Abort bool
+	// Retries is the number of times a failed request to the statistic source is retried before the topic is skipped.
+	Retries int
+}
+
+// NewErrorPolicy parses an `on_error` policy; `abort` (default), `skip_topic`, or `retry:N`.
+func NewErrorPolicy(onError string) (ErrorPolicy, error) {
+	switch {
+	case onError == "" || onError == "abort":
+		return ErrorPolicy{Abort: true}, nil
+	case onError == "skip_topic":
+		return ErrorPolicy{}, nil
+	case strings.HasPrefix(onError, "retry:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(onError, "retry:"))
+		if err != nil || n < 1 {
+			return ErrorPolicy{}, fmt.Errorf("%v is not a valid number of retries", strings.TrimPrefix(onError, "retry:"))
+		}
+		return ErrorPolicy{Retries: n}, nil
+	}
+	return ErrorPolicy{}, fmt.Errorf("%v is not a known error policy", onError)
+}
+
+// TopicError is an error that occurred in a topic.
+type TopicError struct {
+	Topic string `json:"topic"`
+	Error string `json:"error"`
+}
+
+// ErrorReport collects the errors of the topics that failed during a run.
+type ErrorReport struct {
+	errors []TopicError
+	mu     sync.Mutex
+}
+
+// Add records an error for a topic. An error that has already been recorded for the topic is not recorded again.
+func (r *ErrorReport) Add(topic string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := TopicError{Topic: topic, Error: err.Error()}
+	for _, x := range r.errors {
+		if x == e {
+			return
+		}
+	}
+	r.errors = append(r.errors, e)
+}
+
+// Failed reports the topics that have an error.
+func (r *ErrorReport) Failed() map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failed := make(map[string]bool)
+	for _, e := range r.errors {
+		failed[e.Topic] = true
+	}
+	return failed
+}
+
+// HasFailed reports whether a topic has an error.
+func (r *ErrorReport) HasFailed(topic string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.errors {
+		if e.Topic == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns the errors of each topic, with topics in the configured order.
+func (r *ErrorReport) Errors() []TopicError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var topics []string
+	byTopic := make(map[string][]TopicError)
+	for _, e := range r.errors {
+		if _, ok := byTopic[e.Topic]; !ok {
+			topics = append(topics, e.Topic)
+		}
+		byTopic[e.Topic] = append(byTopic[e.Topic], e)
+	}
+	sortTopics(topics)
+	errors := make([]TopicError, 0, len(r.errors))
+	for _, topic := range topics {
+		errors = append(errors, byTopic[topic]...)
+	}
+	return errors
+}
+
+// Write writes the errors of each topic to a file as JSON.
+func (r *ErrorReport) Write(filename string) error {
+	b, err := json.MarshalIndent(r.Errors(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, 0644)
+}
+
+// RetryingStatisticsSource wraps a statistics source, retrying every request that fails. A request that still fails
+// returns its error to the retrieval, measurement, or scorer that made it, which is reported for its topic by the run.
+type RetryingStatisticsSource struct {
+	stats.StatisticsSource
+	Retries int
+}
+
+// NewRetryingStatisticsSource creates a statistics source that retries failed requests to ss.
+func NewRetryingStatisticsSource(ss stats.StatisticsSource, retries int) *RetryingStatisticsSource {
+	return &RetryingStatisticsSource{
+		StatisticsSource: ss,
+		Retries:          retries,
+	}
+}
+
+// retry calls fn until it succeeds, waiting longer between each attempt. Requests with no response recorded in a
+// cassette are not retried.
+func (r *RetryingStatisticsSource) retry(fn func() error) error {
+	err := fn()
+	for attempt := 1; err != nil && !isUnrecorded(err) && attempt <= r.Retries; attempt++ {
+		log.Printf("retrying failed request (attempt %d of %d): %v\n", attempt, r.Retries, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+		err = fn()
+	}
+	return err
+}
+
+func (r *RetryingStatisticsSource) float(fn func() (float64, error)) (float64, error) {
+	var v float64
+	err := r.retry(func() error {
+		var err error
+		v, err = fn()
+		return err
+	})
+	return v, err
+}
+
+func (r *RetryingStatisticsSource) TermFrequency(term, field, document string) (float64, error) {
+	return r.float(func() (float64, error) {
+		return r.StatisticsSource.TermFrequency(term, field, document)
+	})
+}
+
+func (r *RetryingStatisticsSource) DocumentFrequency(term, field string) (float64, error) {
+	return r.float(func() (float64, error) {
+		return r.StatisticsSource.DocumentFrequency(term, field)
+	})
+}
+
+func (r *RetryingStatisticsSource) TotalTermFrequency(term, field string) (float64, error) {
+	return r.float(func() (float64, error) {
+		return r.StatisticsSource.TotalTermFrequency(term, field)
+	})
+}
+
+func (r *RetryingStatisticsSource) InverseDocumentFrequency(term, field string) (float64, error) {
+	return r.float(func() (float64, error) {
+		return r.StatisticsSource.InverseDocumentFrequency(term, field)
+	})
+}
+
+func (r *RetryingStatisticsSource) VocabularySize(field string) (float64, error) {
+	return r.float(func() (float64, error) {
+		return r.StatisticsSource.VocabularySize(field)
+	})
+}
+
+func (r *RetryingStatisticsSource) CollectionSize() (float64, error) {
+	return r.float(func() (float64, error) {
+		return r.StatisticsSource.CollectionSize()
+	})
+}
+
+func (r *RetryingStatisticsSource) RetrievalSize(query cqr.CommonQueryRepresentation) (float64, error) {
+	return r.float(func() (float64, error) {
+		return r.StatisticsSource.RetrievalSize(query)
+	})
+}
+
+func (r *RetryingStatisticsSource) Execute(query pipeline.Query, options stats.SearchOptions) (trecresults.ResultList, error) {
+	var results trecresults.ResultList
+	err := r.retry(func() error {
+		var err error
+		results, err = r.StatisticsSource.Execute(query, options)
+		return err
+	})
+	return results, err
+}
+
+// measurementError is an error that occurred while measuring the query of a topic. groove does not attribute the
+// errors of measurements to a topic, so the topic is kept with the error.
+type measurementError struct {
+	topic string
+	err   error
+}
+
+func (e measurementError) Error() string {
+	return fmt.Sprintf("measurement of topic %v: %v", e.topic, e.err)
+}
+
+func (e measurementError) Unwrap() error {
+	return e.err
+}
+
+// removeFailedTopics removes the results of topics that failed, so that only complete topics are output.
+func removeFailedTopics(failed map[string]bool, measurements, evaluations map[string]map[string]float64, trecResults map[string][]string) {
+	for topic := range failed {
+		delete(measurements, topic)
+		delete(evaluations, topic)
+		delete(trecResults, topic)
+	}
+}
@@ -0,0 +1,89 @@
+package boogie
+
+import (
+	"errors"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlakySource fails the first request for the document frequency of a term.
+type testFlakySource struct {
+	stats.StatisticsSource
+	requests int
+}
+
+func (s *testFlakySource) DocumentFrequency(term, field string) (float64, error) {
+	s.requests++
+	if s.requests == 1 {
+		return 0, errors.New("connection reset")
+	}
+	return s.StatisticsSource.DocumentFrequency(term, field)
+}
+
+func TestRetryingStatisticsSource(t *testing.T) {
+	flaky := &testFlakySource{StatisticsSource: newTestLocalSource(t, "boolean", testMEDLINECollection)}
+	df, err := NewRetryingStatisticsSource(flaky, 1).DocumentFrequency("heart", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if df == 0 || flaky.requests != 2 {
+		t.Errorf("DocumentFrequency() = %v after %d requests, want a frequency after 2", df, flaky.requests)
+	}
+}
+
+// testFailingMeasurement fails to measure the query of topic 2.
+type testFailingMeasurement struct{}
+
+func (testFailingMeasurement) Name() string {
+	return "test_failing"
+}
+
+func (testFailingMeasurement) Execute(q pipeline.Query, s stats.StatisticsSource) (float64, error) {
+	if q.Topic == "2" {
+		return 0, errors.New("index unavailable")
+	}
+	return 1, nil
+}
+
+func TestRunReport(t *testing.T) {
+	RegisterMeasurement("test_failing", testFailingMeasurement{})
+	dsl, dir, cleanup := newTestPipeline(t, map[string]string{"1": "heart", "2": "attack"})
+	defer cleanup()
+	dsl.OnError = "skip_topic"
+	dsl.Measurements = []string{"test_failing"}
+	dsl.Output.Measurements = []MeasurementOutput{{Format: "json", Filename: filepath.Join(dir, "measurements.json")}}
+
+	// Measurements cannot be skipped, so the run is aborted, but the report names the topic.
+	r, err := NewRun(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Execute()
+	if err == nil || !strings.Contains(err.Error(), "index unavailable") {
+		t.Fatalf("Execute() = %v, want the error of the measurement", err)
+	}
+	if errs := r.Report.Errors(); len(errs) != 1 || errs[0].Topic != "2" {
+		t.Errorf("Report.Errors() = %v, want an error in topic 2", errs)
+	}
+
+	// The errors of a run are not reported by the next.
+	dsl.Measurements = nil
+	dsl.Output.Measurements = nil
+	r, err = NewRun(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := r.Report.Errors(); len(errs) != 0 {
+		t.Errorf("Report.Errors() = %v, want none", errs)
+	}
+	if got := readTestRun(t, dsl.Output.Trec.Output); len(got) != 2 {
+		t.Errorf("run = %v, want both topics", got)
+	}
+}
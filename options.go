@@ -0,0 +1,192 @@
+package boogie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/groove/stats"
+	"strings"
+)
+
+// SearchOptions configure retrieval from a statistic source.
+type SearchOptions struct {
+	Size    *int   `json:"size"`
+	RunName string `json:"run_name"`
+}
+
+// searchOptions creates the search options of a statistic source. When a search is configured, 1000 documents are
+// retrieved for the run "run" unless otherwise specified.
+func (o *SearchOptions) searchOptions() stats.SearchOptions {
+	if o == nil {
+		return stats.SearchOptions{}
+	}
+	s := stats.SearchOptions{Size: 1000, RunName: "run"}
+	if o.Size != nil {
+		s.Size = *o.Size
+	}
+	if len(o.RunName) > 0 {
+		s.RunName = o.RunName
+	}
+	return s
+}
+
+// ElasticsearchOptions are the options of the elasticsearch statistic source.
+type ElasticsearchOptions struct {
+	Hosts        []string           `json:"hosts"`
+	Index        string             `json:"index"`
+	DocumentType string             `json:"document_type"`
+	Field        string             `json:"field"`
+	Analyser     string             `json:"analyser"`
+	AnalyseField string             `json:"analyse_field"`
+	Scroll       bool               `json:"scroll"`
+	Search       *SearchOptions     `json:"search"`
+	Params       map[string]float64 `json:"params"`
+	// Username and Password authenticate with basic auth, or APIKey with an (encoded) API key.
+	Username Secret `json:"username"`
+	Password Secret `json:"password"`
+	APIKey   Secret `json:"api_key"`
+	// CACert is a PEM file of certificates to trust in addition to those of the system.
+	CACert string `json:"ca_cert"`
+	// Timeout is how long to wait for a response to each request (e.g. 90s).
+	Timeout string `json:"timeout"`
+	// Model re-ranks the documents retrieved for each query with a retrieval model (bm25, lm_dirichlet, or
+	// lm_jelinek_mercer), configured by params.
+	Model string `json:"model"`
+}
+
+// hosts are the Elasticsearch hosts, or http://localhost:9200 if none are specified.
+func (o ElasticsearchOptions) hosts() []string {
+	if len(o.Hosts) == 0 {
+		return []string{"http://localhost:9200"}
+	}
+	return o.Hosts
+}
+
+// index is the Elasticsearch index, or "index" if none is specified.
+func (o ElasticsearchOptions) index() string {
+	if len(o.Index) == 0 {
+		return "index"
+	}
+	return o.Index
+}
+
+// EntrezOptions are the options of the entrez statistic source.
+type EntrezOptions struct {
+	Email  string             `json:"email"`
+	Tool   string             `json:"tool"`
+	Key    string             `json:"key"`
+	Rank   bool               `json:"rank"`
+	Search *SearchOptions     `json:"search"`
+	Params map[string]float64 `json:"params"`
+	// DB is the Entrez database to search (pubmed by default).
+	DB string `json:"db"`
+	// RequestsPerSecond limits the rate of requests (at most 3, or 10 with a key).
+	RequestsPerSecond *float64 `json:"requests_per_second"`
+	// Retries is the number of times a request that fails with a 429 or 5xx response is retried (5 by default).
+	Retries *int `json:"retries"`
+}
+
+// PubMedBaselineOptions are the options of the pubmed_baseline statistic source.
+type PubMedBaselineOptions struct {
+	// Store is the directory the baseline is stored in.
+	Store string `json:"store"`
+	// Baseline are the baseline (and update) files to ingest, in order, which may be patterns (e.g. pubmed*.xml.gz).
+	Baseline []string           `json:"baseline"`
+	Rank     bool               `json:"rank"`
+	Search   *SearchOptions     `json:"search"`
+	Params   map[string]float64 `json:"params"`
+}
+
+// TerrierOptions are the options of the terrier statistic source.
+type TerrierOptions struct {
+	Properties string             `json:"properties"`
+	URL        string             `json:"url"`
+	Field      string             `json:"field"`
+	Search     *SearchOptions     `json:"search"`
+	Params     map[string]float64 `json:"params"`
+}
+
+// LocalOptions are the options of the local statistic source.
+type LocalOptions struct {
+	// Index is the file of the index, which is built from the collection if it does not exist.
+	Index      string `json:"index"`
+	Collection string `json:"collection"`
+	// Format is the format of the collection (jsonl, trec, or medline).
+	Format string `json:"format"`
+	// IDField is the field of the id of each document in a jsonl collection.
+	IDField string             `json:"id_field"`
+	Field   string             `json:"field"`
+	Model   string             `json:"model"`
+	Search  *SearchOptions     `json:"search"`
+	Params  map[string]float64 `json:"params"`
+}
+
+// TransmuteQueryOptions are the options of the medline, pubmed, and cqr query sources.
+type TransmuteQueryOptions struct {
+	// Mapping maps the fields of queries to the fields of the index.
+	Mapping map[string][]string `json:"mapping"`
+}
+
+// KeywordQueryOptions are the options of the keyword query source.
+type KeywordQueryOptions struct {
+	Fields []string `json:"fields"`
+}
+
+// CacheOptions are the options of the memory cache.
+type CacheOptions struct {
+	Invalidate bool     `json:"invalidate"`
+	Scope      []string `json:"scope"`
+}
+
+// FileCacheOptions are the options of the file cache.
+type FileCacheOptions struct {
+	CacheOptions
+	Path string `json:"path"`
+}
+
+// ScorerOptions are the options of a scorer.
+type ScorerOptions struct {
+	K1     *float64 `json:"k1"`
+	B      *float64 `json:"b"`
+	Fields []string `json:"fields"`
+}
+
+// GenerateOptions configure the generation of training data by a learning model.
+type GenerateOptions struct {
+	Output    string  `json:"output"`
+	Traversal string  `json:"traversal"`
+	Budget    int     `json:"budget"`
+	Sampler   string  `json:"sampler"`
+	Measure   string  `json:"measure"`
+	Scores    string  `json:"scores"`
+	Strategy  string  `json:"strategy"`
+	N         int     `json:"n"`
+	Delta     float64 `json:"delta"`
+	K         *int    `json:"k"`
+}
+
+// decodeOptions decodes the options of a component into a typed struct, reporting unknown options and options of the
+// wrong type.
+func decodeOptions(component string, options map[string]interface{}, v interface{}) error {
+	if options == nil {
+		return nil
+	}
+	b, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	err = d.Decode(v)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *json.UnmarshalTypeError:
+		return fmt.Errorf("%s option %s must be of type %s, got %s", component, e.Field, e.Type, e.Value)
+	default:
+		if strings.HasPrefix(err.Error(), "json: unknown field ") {
+			return fmt.Errorf("%s has no option %s", component, strings.TrimPrefix(err.Error(), "json: unknown field "))
+		}
+		return fmt.Errorf("%s options: %v", component, err)
+	}
+}
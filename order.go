@@ -0,0 +1,123 @@
+package boogie
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode"
+)
+
+// TopicOrder sorts topics in place.
+type TopicOrder func(topics []string)
+
+// topicOrder is the order that topics are output in, configured by the `order` output option.
+var topicOrder TopicOrder = NaturalTopicOrder
+
+// NaturalTopicOrder sorts topics so that numbers within topics are compared numerically (e.g. 2 before 10).
+func NaturalTopicOrder(topics []string) {
+	sort.SliceStable(topics, func(i, j int) bool {
+		return naturalLess(topics[i], topics[j])
+	})
+}
+
+// LexicalTopicOrder sorts topics as strings.
+func LexicalTopicOrder(topics []string) {
+	sort.Strings(topics)
+}
+
+// QueryTopicOrder sorts topics in the order they appear in queries.
+// Topics which do not appear in queries are placed afterwards in natural order.
+func QueryTopicOrder(queries []string) TopicOrder {
+	position := make(map[string]int)
+	for i, topic := range queries {
+		if _, ok := position[topic]; !ok {
+			position[topic] = i
+		}
+	}
+	return func(topics []string) {
+		sort.SliceStable(topics, func(i, j int) bool {
+			pi, iok := position[topics[i]]
+			pj, jok := position[topics[j]]
+			switch {
+			case iok && jok:
+				return pi < pj
+			case iok != jok:
+				return iok
+			}
+			return naturalLess(topics[i], topics[j])
+		})
+	}
+}
+
+// naturalLess compares two strings, comparing runs of digits numerically.
+func naturalLess(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if unicode.IsDigit(ra[i]) && unicode.IsDigit(rb[j]) {
+			si, sj := i, j
+			for i < len(ra) && unicode.IsDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && unicode.IsDigit(rb[j]) {
+				j++
+			}
+			na, errA := strconv.ParseUint(string(ra[si:i]), 10, 64)
+			nb, errB := strconv.ParseUint(string(rb[sj:j]), 10, 64)
+			if errA != nil || errB != nil {
+				// The numbers are too large, so compare them by length and then as strings.
+				if i-si != j-sj {
+					return i-si < j-sj
+				}
+				if x, y := string(ra[si:i]), string(rb[sj:j]); x != y {
+					return x < y
+				}
+				continue
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if ra[i] != rb[j] {
+			return ra[i] < rb[j]
+		}
+		i++
+		j++
+	}
+	if len(ra)-i != len(rb)-j {
+		return len(ra)-i < len(rb)-j
+	}
+	return a < b
+}
+
+// sortTopics sorts topics in the configured order.
+func sortTopics(topics []string) {
+	topicOrder(topics)
+}
+
+// NewTopicOrder creates the order of topics from the `order` output option of the DSL; `natural` (default),
+// `lexical`, or `query` (the order the queries are loaded in).
+func NewTopicOrder(dsl Pipeline) (TopicOrder, error) {
+	switch dsl.Output.Order {
+	case "", "natural":
+		return NaturalTopicOrder, nil
+	case "lexical":
+		return LexicalTopicOrder, nil
+	case "query":
+		s, ok := querySourceMapping[dsl.Query.Format]
+		if !ok {
+			return nil, fmt.Errorf("%v is not a known query source", dsl.Query.Format)
+		}
+		queries, err := s.Load(dsl.Query.Path)
+		if err != nil {
+			return nil, err
+		}
+		topics := make([]string, len(queries))
+		for i, q := range queries {
+			topics[i] = q.Topic
+		}
+		return QueryTopicOrder(topics), nil
+	}
+	return nil, fmt.Errorf("%v is not a known topic order", dsl.Output.Order)
+}
@@ -0,0 +1,55 @@
+package boogie
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want bool
+	}{
+		{"2", "10", true},
+		{"10", "2", false},
+		{"CD008", "CD010", true},
+		{"topic9", "topic10", true},
+		{"a", "b", true},
+		{"a", "a1", true},
+		{"a1", "a", false},
+		{"a1b", "a1c", true},
+		// Numbers with leading zeros are equal numerically, so they are compared as strings.
+		{"01", "1", true},
+		{"1", "01", false},
+		{"x", "x", false},
+		// Numbers too large to parse are compared by length.
+		{"99999999999999999999", "100000000000000000000", true},
+		{"100000000000000000000", "99999999999999999999", false},
+	} {
+		if got := naturalLess(test.a, test.b); got != test.want {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestTopicOrder(t *testing.T) {
+	topics := []string{"10", "CD2", "2", "CD10", "1"}
+
+	natural := append([]string{}, topics...)
+	NaturalTopicOrder(natural)
+	if want := []string{"1", "2", "10", "CD2", "CD10"}; !reflect.DeepEqual(natural, want) {
+		t.Errorf("natural order = %v, want %v", natural, want)
+	}
+
+	lexical := append([]string{}, topics...)
+	LexicalTopicOrder(lexical)
+	if want := []string{"1", "10", "2", "CD10", "CD2"}; !reflect.DeepEqual(lexical, want) {
+		t.Errorf("lexical order = %v, want %v", lexical, want)
+	}
+
+	query := append([]string{}, topics...)
+	QueryTopicOrder([]string{"CD10", "2", "CD10"})(query)
+	if want := []string{"CD10", "2", "1", "10", "CD2"}; !reflect.DeepEqual(query, want) {
+		t.Errorf("query order = %v, want %v", query, want)
+	}
+}
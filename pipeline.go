@@ -11,6 +11,7 @@ import (
 	"github.com/hscells/cui2vec"
 	"github.com/hscells/groove"
 	"github.com/hscells/groove/analysis"
+	"github.com/hscells/groove/analysis/preqpp"
 	"github.com/hscells/groove/eval"
 	"github.com/hscells/groove/formulation"
 	"github.com/hscells/groove/learning"
@@ -29,14 +30,39 @@ import (
 	"strconv"
 )
 
-// CreatePipeline creates the main groove pipeline.
+// CreatePipeline creates the main groove pipeline. The run of each topic is re-ranked and fused by boogie once groove
+// has retrieved it, so pipelines with a scorer or several sources must be created and executed with NewRun instead.
 func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
+	r, err := NewRun(dsl)
+	if err != nil {
+		return groove.Pipeline{}, err
+	}
+	return r.Pipeline, nil
+}
+
+// createPipeline creates the groove pipeline of a run.
+func createPipeline(dsl Pipeline, r *Run) (groove.Pipeline, error) {
 	// Register the sources used in the groove pipeline.
 	err := RegisterSources(dsl)
 	if err != nil {
 		return groove.Pipeline{}, err
 	}
 
+	// groove caches measurements regardless of the caches configured, so they are removed when a cache is invalidated.
+	for _, c := range dsl.Cache {
+		options, err := cacheOptions(c)
+		if err != nil {
+			return groove.Pipeline{}, err
+		}
+		if options.Invalidate {
+			err = invalidateMeasurementCache()
+			if err != nil {
+				return groove.Pipeline{}, err
+			}
+			break
+		}
+	}
+
 	eval.RelevanceGrade = dsl.Output.Evaluations.RelevanceGrade
 
 	// Create a groove pipeline from the boogie dsl.
@@ -46,20 +72,101 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 	if len(dsl.Query.Path) > 0 {
 		if s, ok := querySourceMapping[dsl.Query.Format]; ok {
 			g.QueriesSource = s
+			// Topics which completed in a previous run are skipped when resuming.
+			if dsl.Checkpoint.Resume {
+				completed, err := CompletedTopics(dsl)
+				if err != nil {
+					return g, err
+				}
+				g.QueriesSource = ResumedQueriesSource{QueriesSource: s, Completed: completed}
+			}
 		} else {
 			return g, fmt.Errorf("%v is not a known query source", dsl.Query.Format)
 		}
 	}
 
-	if len(dsl.Statistic.Source) > 0 {
+	if len(dsl.Statistic.Sources) > 0 {
+		// The runs of multiple statistic sources are fused into a single run, once groove has retrieved the run of the
+		// first.
+		r.fusion, err = NewFusionFromDSL(dsl)
+		if err != nil {
+			return g, err
+		}
+		g.StatisticsSource = r.fusion.Sources[0].Source
+	} else if len(dsl.Statistic.Source) > 0 {
 		if s, ok := statisticSourceMapping[dsl.Statistic.Source]; ok {
-			g.StatisticsSource = s
+			// Retrieval results and term statistics can be cached if configured.
+			g.StatisticsSource, err = NewCachedStatisticsSourceFromDSL(s, dsl.Cache, dsl.Statistic)
+			if err != nil {
+				return g, err
+			}
 		} else {
 			return g, fmt.Errorf("%v is not a known statistics source", dsl.Statistic.Source)
 		}
 	}
 
-	if len(dsl.Statistic.Source) == 0 && len(dsl.Measurements) > 0 {
+	// The documents retrieved for queries are cached as configured, rather than in the persistent cache of groove.
+	g.QueryCache = NewMapQueryCache()
+	if r.fusion != nil {
+		g.QueryCache = r.fusion.Sources[0].cache
+	} else if qc, ok := queryCacheMapping[dsl.Statistic.Source]; ok {
+		g.QueryCache = qc
+	}
+
+	// Failed requests to the statistics source can be retried, and topics that still fail skipped.
+	policy, err := NewErrorPolicy(dsl.OnError)
+	if err != nil {
+		return g, err
+	}
+	if r.fusion != nil && !policy.Abort {
+		for i, source := range r.fusion.Sources {
+			r.fusion.Sources[i].Source = NewRetryingStatisticsSource(source.Source, policy.Retries)
+		}
+		g.StatisticsSource = r.fusion.Sources[0].Source
+	} else if g.StatisticsSource != nil && !policy.Abort {
+		g.StatisticsSource = NewRetryingStatisticsSource(g.StatisticsSource, policy.Retries)
+	}
+
+	// The run of each topic can be re-ranked using a scorer once it has been retrieved.
+	if len(dsl.Scorer) > 0 {
+		scorer, ok := scorers[dsl.Scorer]
+		if !ok {
+			return g, fmt.Errorf("%v is not a known scorer", dsl.Scorer)
+		}
+		if g.StatisticsSource == nil {
+			return g, fmt.Errorf("a statistic source is required to re-rank using a scorer")
+		}
+		fields, err := scorerFields(dsl.ScorerOptions)
+		if err != nil {
+			return g, err
+		}
+		r.reranker = &Reranker{Source: g.StatisticsSource, Scorer: scorer, Fields: fields}
+	}
+
+	// The run of an elasticsearch source with a retrieval model is re-ranked by it, and the queries of an elasticsearch
+	// source with a field search it. When fusing, the queries of the first source are those of every other source that
+	// does not have its own field.
+	var field string
+	if r.fusion != nil {
+		field = r.fusion.Sources[0].Field
+	} else if len(dsl.Statistic.Source) > 0 {
+		search, err := NewElasticsearchSearch(dsl.Statistic.Source, dsl.Statistic.Options)
+		if err != nil {
+			return g, err
+		}
+		if search.Model != nil {
+			if r.reranker != nil {
+				return g, fmt.Errorf("a scorer cannot be used with the model of the elasticsearch source")
+			}
+			r.reranker = &Reranker{Source: g.StatisticsSource, Scorer: search.Model}
+		}
+		field = search.Field
+	}
+	if len(field) > 0 && g.QueriesSource != nil {
+		g.QueriesSource = FieldQueriesSource{QueriesSource: g.QueriesSource, Field: field}
+	}
+
+	if g.StatisticsSource == nil && len(dsl.Measurements) > 0 {
 		return g, fmt.Errorf("a statistic source is required for measurements")
 	}
 
@@ -79,10 +186,34 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 		return g, fmt.Errorf("at least one evaluation measurement must be supplied for the output formats")
 	}
 
+	if dsl.Checkpoint.Resume && len(dsl.Checkpoint.Path) == 0 {
+		return g, fmt.Errorf("a checkpoint path must be supplied to resume a run")
+	}
+
+	if len(dsl.Output.Evaluations.Baseline) > 0 && len(dsl.Output.Evaluations.Significance) == 0 {
+		return g, fmt.Errorf("a significance file must be supplied when comparing evaluations to a baseline")
+	}
+
+	// groove caches measurements by query and name only, so the name of each measurement also identifies the
+	// statistic source it is computed with.
+	statistic := interface{}(dsl.Statistic)
+	if len(dsl.Statistic.Sources) > 0 {
+		statistic = dsl.Statistic.Sources[0]
+	}
+	source, err := cachePrefix(statistic)
+	if err != nil {
+		return g, err
+	}
 	g.Measurements = []analysis.Measurement{}
 	for _, measurementName := range dsl.Measurements {
 		if m, ok := measurementMapping[measurementName]; ok {
-			g.Measurements = append(g.Measurements, m)
+			// Measurements are computed using the statistics source of the pipeline, rather than the one groove retrieves
+			// with. The term frequency measurement only works with the entrez source, which wrapping hides from it.
+			ss := g.StatisticsSource
+			if _, ok := m.(preqpp.TF); ok {
+				ss = unwrapStatisticsSource(ss)
+			}
+			g.Measurements = append(g.Measurements, sourcedMeasurement{Measurement: m, source: ss, key: source})
 		} else {
 			return g, fmt.Errorf("%v is not a known measurement", measurementName)
 		}
@@ -151,6 +282,16 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 	for _, formatter := range dsl.Output.Measurements {
 		if o, ok := measurementFormatters[formatter.Format]; ok {
 			g.MeasurementFormatters = append(g.MeasurementFormatters, o)
+		} else if _, ok := labelledMeasurementFormatters[formatter.Format]; ok {
+			// Labelled formatters are output by boogie, as the labels are only known once the pipeline has finished.
+			if len(formatter.Label) == 0 {
+				return g, fmt.Errorf("a label must be specified for the %v measurement output format", formatter.Format)
+			}
+			// groove only computes measurements when there is a formatter to output them to, so one that outputs
+			// nothing stands in for the labelled formatter.
+			g.MeasurementFormatters = append(g.MeasurementFormatters, func(topics, headers []string, data [][]float64) (string, error) {
+				return "", nil
+			})
 		} else {
 			return g, fmt.Errorf("%v is not a known measurement output format", formatter.Format)
 		}
@@ -179,7 +320,13 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 		if transformation, ok := transformationMappingBoolean[t]; ok {
 			g.Transformations.BooleanTransformations = append(g.Transformations.BooleanTransformations, transformation)
 		} else if transformation, ok := transformationMappingElasticsearch[t]; ok {
-			g.Transformations.ElasticsearchTransformations = append(g.Transformations.ElasticsearchTransformations, transformation)
+			// groove requires the Elasticsearch source itself for these, so they are applied as Boolean transformations
+			// on the source underneath any wrapping.
+			b, err := unwrappedTransformation(transformation, g.StatisticsSource)
+			if err != nil {
+				return g, err
+			}
+			g.Transformations.BooleanTransformations = append(g.Transformations.BooleanTransformations, b)
 		} else {
 			return g, fmt.Errorf("%v is not a known preprocessing transformation", t)
 		}
@@ -219,249 +366,14 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 				m.Transformations = transformations
 				m.StatisticsSource = g.StatisticsSource
 				if g.ModelConfiguration.Generate {
-					m.GenerationFile = dsl.Learning.Generate["output"].(string)
-
-					traversal := dsl.Learning.Generate["traversal"].(string)
-					if traversal == "depth_first" {
-						var (
-							measure string
-							sampler learning.DepthFirstSamplingCriteria
-							budget  int
-						)
-						if v, ok := dsl.Learning.Generate["budget"]; ok {
-							budget = int(v.(float64))
-						}
-
-						if s, ok := dsl.Learning.Generate["sampler"].(string); ok {
-							if v, ok := dsl.Learning.Generate["measure"].(string); ok {
-								measure = v
-							}
-							switch s {
-							case "evaluation":
-								var (
-									e      eval.Evaluator
-									scores map[string]map[string]float64
-								)
-
-								// Configure the evaluation measure used in sampling.
-								if m, ok := evaluationMapping[measure]; ok {
-									e = m
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("%s is not a valid evaluation measure for sampling", measure)
-								}
-
-								// Configure loading of the scores for sampling.
-								if v, ok := dsl.Learning.Generate["scores"]; ok {
-									path := v.(string)
-									f, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-									b, err := ioutil.ReadAll(f)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-									err = json.Unmarshal(b, &scores)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-								} else {
-									return groove.Pipeline{}, errors.New("no scores parameter defined")
-								}
-
-								// Configure the sampling strategy.
-								if v, ok := dsl.Learning.Generate["strategy"]; ok {
-									switch v.(string) {
-									case "positive":
-										sampler = learning.PositiveBiasedEvaluationSamplingCriteria(e, scores, m)
-									case "negative":
-										sampler = learning.NegativeBiasedEvaluationSamplingCriteria(e, scores, m)
-									case "balanced":
-										sampler = learning.BalancedEvaluationSamplingCriteria(e, scores, m)
-									}
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("unknown greedy sampling strategy %v", v)
-								}
-							case "transformation":
-								// Configure the sampling strategy.
-								if v, ok := dsl.Learning.Generate["strategy"]; ok {
-									switch v.(string) {
-									case "balanced":
-										sampler = learning.BalancedTransformationSamplingCriteria(learning.ChainFeatures)
-									case "biased":
-										sampler = learning.BiasedTransformationSamplingCriteria()
-									}
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("unknown greedy sampling strategy %v", v)
-								}
-							case "random":
-								sampler = learning.ProbabilisticSamplingCriteria(0.65)
-							}
-						} else {
-							return groove.Pipeline{}, fmt.Errorf("ensure that a sampler is configured when generating data")
-						}
-						m.GenerationExplorer = learning.NewDepthFirstExplorer(m, sampler, budget)
-					} else if traversal == "breadth_first" {
-						var (
-							n       int
-							delta   float64
-							measure string
-							sampler learning.Sampler
-						)
-						if s, ok := dsl.Learning.Generate["sampler"].(string); ok {
-							if v, ok := dsl.Learning.Generate["n"]; ok {
-								n = int(v.(float64))
-							}
-							if v, ok := dsl.Learning.Generate["delta"].(float64); ok {
-								delta = v
-							}
-							if v, ok := dsl.Learning.Generate["measure"].(string); ok {
-								measure = v
-							}
-							switch s {
-							case "greedy":
-								if len(measure) == 0 {
-									return groove.Pipeline{}, errors.New("mis-configured measure for greedy sampler")
-								}
-								var (
-									e        eval.Evaluator
-									strategy learning.GreedyStrategy
-									scores   map[string]map[string]float64
-								)
-
-								// Configure the evaluation measure used in sampling.
-								if m, ok := evaluationMapping[measure]; ok {
-									e = m
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("%s is not a valid evaluation measure for sampling", measure)
-								}
-
-								// Configure loading of the scores for sampling.
-								if v, ok := dsl.Learning.Generate["scores"]; ok {
-									path := v.(string)
-									f, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-									b, err := ioutil.ReadAll(f)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-									err = json.Unmarshal(b, &scores)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-								} else {
-									return groove.Pipeline{}, errors.New("no scores parameter defined")
-								}
-
-								// Configure the sampling strategy.
-								if v, ok := dsl.Learning.Generate["strategy"]; ok {
-									switch v.(string) {
-									case "naive":
-										strategy = learning.RankedGreedyStrategy
-									case "diversified":
-										strategy = learning.MaximalMarginalRelevanceGreedyStrategy(scores, 0.3, cui2vec.Cosine, e)
-									}
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("unknown greedy sampling strategy %v", v)
-								}
-
-								sampler = learning.NewGreedySampler(n, delta, e, m, strategy)
-								break
-							case "evaluation":
-								if len(measure) == 0 {
-									return groove.Pipeline{}, errors.New("mis-configured measure for evaluation sampler")
-								}
-								var (
-									e        eval.Evaluator
-									strategy learning.ScoredStrategy
-									scores   map[string]map[string]float64
-								)
-
-								// Configure the evaluation measure used in sampling.
-								if m, ok := evaluationMapping[measure]; ok {
-									e = m
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("%s is not a valid evaluation measure for sampling", measure)
-								}
-
-								// Configure the sampling strategy.
-								if v, ok := dsl.Learning.Generate["strategy"]; ok {
-									switch v.(string) {
-									case "positive_biased":
-										strategy = learning.PositiveBiasScoredStrategy
-									case "negative_biased":
-										strategy = learning.NegativeBiasScoredStrategy
-									case "balanced":
-										strategy = learning.BalancedScoredStrategy
-									case "stratified":
-										strategy = learning.StratifiedScoredStrategy
-									case "diversified":
-										strategy = learning.MaximalMarginalRelevanceScoredStrategy(0.3, cui2vec.Cosine)
-									}
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("unknown evaluation sampling strategy %v", v)
-								}
-
-								// Configure loading of the scores for sampling.
-								if v, ok := dsl.Learning.Generate["scores"]; ok {
-									path := v.(string)
-									f, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-									b, err := ioutil.ReadAll(f)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-									err = json.Unmarshal(b, &scores)
-									if err != nil {
-										return groove.Pipeline{}, err
-									}
-								} else {
-									return groove.Pipeline{}, errors.New("no scores parameter defined")
-								}
-
-								sampler = learning.NewEvaluationSampler(n, delta, e, m, scores, strategy)
-								break
-							case "transformation":
-								var strategy learning.TransformationStrategy
-
-								// Configure the sampling strategy.
-								if v, ok := dsl.Learning.Generate["strategy"]; ok {
-									switch v.(string) {
-									case "stratified":
-										strategy = learning.StratifiedTransformationStrategy
-									case "balanced":
-										strategy = learning.BalancedTransformationStrategy
-									}
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("unknown transformation sampling strategy %v", v)
-								}
-
-								sampler = learning.NewTransformationSampler(n, delta, strategy)
-								break
-							case "random":
-								sampler = learning.NewRandomSampler(n, delta)
-							case "cluster":
-								var k int
-								// Configure the evaluation measure used in sampling.
-								if v, ok := dsl.Learning.Generate["k"].(float64); ok {
-									k = int(k)
-								} else {
-									return groove.Pipeline{}, fmt.Errorf("%v is not a valid value for k", v)
-								}
-
-								sampler = learning.NewClusterSampler(n, delta, k)
-							default:
-								return groove.Pipeline{}, fmt.Errorf("%s is not a valid sampler", s)
-							}
-						} else {
-							return groove.Pipeline{}, fmt.Errorf("ensure that a sampler is configured when generating data")
-						}
-
-						m.GenerationExplorer = learning.NewBreadthFirstExplorer(m, sampler, learning.DepthStoppingCondition(5))
+					var options GenerateOptions
+					err := decodeOptions("learning generate", dsl.Learning.Generate, &options)
+					if err != nil {
+						return g, err
+					}
+					err = configureGeneration(m, options)
+					if err != nil {
+						return g, err
 					}
 				}
 			default:
@@ -503,24 +415,24 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 				fmt.Println(dsl.Formulation.Options["entity_expander.cui2vec_rpc"])
 				client, err := cui2vec.NewVecClient(dsl.Formulation.Options["entity_expander.cui2vec_rpc"])
 				if err != nil {
-					panic(err)
+					return g, err
 				}
 				f, err := os.Open(dsl.Formulation.Options["logic_composer.titles"])
 				if err != nil {
-					panic(err)
+					return g, err
 				}
 				titles := make(map[string]string)
 				err = json.NewDecoder(f).Decode(&titles)
 				if err != nil {
-					panic(err)
+					return g, err
 				}
 				q, err := os.Open(dsl.Formulation.Options["logic_composer.dev_qrels"])
 				if err != nil {
-					panic(err)
+					return g, err
 				}
 				qrels, err := trecresults.QrelsFromReader(q)
 				if err != nil {
-					panic(err)
+					return g, err
 				}
 				composer = formulation.NewRAKELogicComposer(dsl.Formulation.Options["semtypes"], dsl.Formulation.Options["metamap_url"], titles, qrels, elasticClient, client)
 			}
@@ -548,15 +460,15 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 			case "cui2vec_rpc":
 				client, err := cui2vec.NewVecClient(dsl.Formulation.Options["entity_expander.cui2vec_rpc"])
 				if err != nil {
-					panic(err)
+					return g, err
 				}
 				expander = formulation.NewCui2VecRPCEntityExpander(client)
-			//case "medgen":
-			//	e, err := NewEntrezStatisticsSource(dsl.Statistic.Options, stats.EntrezDb("medgen"))
-			//	if err != nil {
-			//		return g, err
-			//	}
-			//	expander = formulation.NewMedGenExpander(e)
+			case "medgen":
+				e, err := NewEntrezStatisticsSource(dsl.Statistic.Options)
+				if err != nil {
+					return g, err
+				}
+				expander = NewMedGenEntityExpander(e)
 			default:
 				expander = nil
 			}
@@ -643,8 +555,16 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 			//}
 			//}
 
-			g.QueryFormulator = formulation.NewConceptualFormulator(composer, extractor, expander, mapper, pmids, g.StatisticsSource.(stats.EntrezStatisticsSource), processing...)
+			e, ok := unwrapStatisticsSource(g.StatisticsSource).(stats.EntrezStatisticsSource)
+			if !ok {
+				return g, fmt.Errorf("the %s formulator requires the entrez source", dsl.Formulation.Method)
+			}
+			g.QueryFormulator = formulation.NewConceptualFormulator(composer, extractor, expander, mapper, pmids, e, processing...)
 		case "objective":
+			e, ok := unwrapStatisticsSource(g.StatisticsSource).(stats.EntrezStatisticsSource)
+			if !ok {
+				return g, fmt.Errorf("the %s formulator requires the entrez source", dsl.Formulation.Method)
+			}
 			topic := dsl.Formulation.Options["topic"]
 			folder := dsl.Formulation.Options["folder"]
 			pubdates := dsl.Formulation.Options["pubdates"]
@@ -652,7 +572,7 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 			metamap := dsl.Formulation.Options["metamap"]
 			seed, err := strconv.Atoi(dsl.Formulation.Options["seed"])
 			if err != nil {
-				panic(err)
+				return g, err
 			}
 			optimisation, ok := evaluationMapping[dsl.Formulation.Options["optimisation"]]
 			if !ok {
@@ -681,9 +601,9 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 
 			switch dsl.Formulation.Options["background_collection"] {
 			case "pubmed":
-				population = formulation.NewPubMedSet(g.StatisticsSource.(stats.EntrezStatisticsSource))
+				population = formulation.NewPubMedSet(e)
 			case "top10000":
-				population, err = formulation.GetPopulationSet(g.StatisticsSource.(stats.EntrezStatisticsSource), analyser)
+				population, err = formulation.GetPopulationSet(e, analyser)
 				if err != nil {
 					return g, err
 				}
@@ -721,7 +641,7 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 				}
 			}
 			qrels := g.EvaluationFormatters.EvaluationQrels
-			g.QueryFormulator = formulation.NewObjectiveFormulator(g.StatisticsSource.(stats.EntrezStatisticsSource), elasticClient, qrels, population, folder, pubdates, semtypes, metamap, optimisation,
+			g.QueryFormulator = formulation.NewObjectiveFormulator(e, elasticClient, qrels, population, folder, pubdates, semtypes, metamap, optimisation,
 				formulation.ObjectiveAnalyser(analyser, dsl.Formulation.Options["analyser"]),
 				formulation.ObjectiveSplitter(splitter),
 				formulation.ObjectiveMinDocs(minDocs),
@@ -746,10 +666,9 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 				}
 			}
 
-			e, ok := g.StatisticsSource.(stats.EntrezStatisticsSource)
+			e, ok := unwrapStatisticsSource(g.StatisticsSource).(stats.EntrezStatisticsSource)
 			if !ok {
-				return g, errors.New("the entrez statistics source must be configured to use the dt formulator")
-
+				return g, fmt.Errorf("the %s formulator requires the entrez source", dsl.Formulation.Method)
 			}
 			fmt.Println(len(p), len(n))
 
@@ -781,6 +700,12 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 	}
 
 	g.CLF = dsl.CLFOptions
+	if g.CLF.CLF {
+		// groove ranks with the entrez source itself, so it cannot be cached, fused, re-ranked, or retried.
+		if _, ok := g.StatisticsSource.(stats.EntrezStatisticsSource); !ok || r.postprocessed() {
+			return g, fmt.Errorf("clf requires the entrez statistic source, without a cache, sources, scorer, or on_error policy")
+		}
+	}
 	if g.CLF.CLFVariations {
 		// First, load the cui2vec embeddings.
 		f, err := os.OpenFile(dsl.Utilities.CUI2vec, os.O_RDONLY, 0664)
@@ -816,6 +741,19 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 	g.Transformations.Output = dsl.Transformations.Output
 	g.OutputTrec.Path = dsl.Output.Trec.Output
 
+	// groove retrieves the documents of queries with the Elasticsearch source itself, so that it scrolls through them.
+	g.StatisticsSource = retrievalSource(g.StatisticsSource)
+
+	// Runs that are changed by boogie once they have been retrieved are evaluated by boogie afterwards, so groove only
+	// retrieves them. groove sends the runs it retrieves when it has a trec output, which it never writes to.
+	if r.postprocessed() {
+		r.evaluators = g.Evaluations
+		g.Evaluations = nil
+		if len(g.OutputTrec.Path) == 0 && len(g.EvaluationFormatters.EvaluationFormatters) > 0 {
+			g.OutputTrec.Path = os.DevNull
+		}
+	}
+
 	var hw *headway.Client
 	if len(dsl.Headway.Host) > 0 {
 		hw = headway.NewClient(dsl.Headway.Host, dsl.Headway.Secret)
@@ -823,3 +761,168 @@ func CreatePipeline(dsl Pipeline) (groove.Pipeline, error) {
 	g.Headway = hw
 	return g, nil
 }
+
+// loadSamplingScores loads the scores used to sample training data.
+func loadSamplingScores(options GenerateOptions) (map[string]map[string]float64, error) {
+	if len(options.Scores) == 0 {
+		return nil, errors.New("no scores parameter defined")
+	}
+	var scores map[string]map[string]float64
+	b, err := ioutil.ReadFile(options.Scores)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &scores)
+	return scores, err
+}
+
+// samplingMeasure is the evaluation measure used in sampling.
+func samplingMeasure(options GenerateOptions) (eval.Evaluator, error) {
+	if e, ok := evaluationMapping[options.Measure]; ok {
+		return e, nil
+	}
+	return nil, fmt.Errorf("%s is not a valid evaluation measure for sampling", options.Measure)
+}
+
+// configureGeneration configures how a query chain generates training data from the `generate` options of the DSL.
+func configureGeneration(m *learning.QueryChain, options GenerateOptions) error {
+	m.GenerationFile = options.Output
+	if len(options.Sampler) == 0 {
+		return fmt.Errorf("ensure that a sampler is configured when generating data")
+	}
+
+	switch options.Traversal {
+	case "depth_first":
+		var sampler learning.DepthFirstSamplingCriteria
+		switch options.Sampler {
+		case "evaluation":
+			e, err := samplingMeasure(options)
+			if err != nil {
+				return err
+			}
+			scores, err := loadSamplingScores(options)
+			if err != nil {
+				return err
+			}
+
+			// Configure the sampling strategy.
+			switch options.Strategy {
+			case "positive":
+				sampler = learning.PositiveBiasedEvaluationSamplingCriteria(e, scores, m)
+			case "negative":
+				sampler = learning.NegativeBiasedEvaluationSamplingCriteria(e, scores, m)
+			case "balanced":
+				sampler = learning.BalancedEvaluationSamplingCriteria(e, scores, m)
+			default:
+				return fmt.Errorf("unknown evaluation sampling strategy %v", options.Strategy)
+			}
+		case "transformation":
+			// Configure the sampling strategy.
+			switch options.Strategy {
+			case "balanced":
+				sampler = learning.BalancedTransformationSamplingCriteria(learning.ChainFeatures)
+			case "biased":
+				sampler = learning.BiasedTransformationSamplingCriteria()
+			default:
+				return fmt.Errorf("unknown transformation sampling strategy %v", options.Strategy)
+			}
+		case "random":
+			sampler = learning.ProbabilisticSamplingCriteria(0.65)
+		default:
+			return fmt.Errorf("%s is not a valid sampler", options.Sampler)
+		}
+		m.GenerationExplorer = learning.NewDepthFirstExplorer(m, sampler, options.Budget)
+	case "breadth_first":
+		var (
+			n       = options.N
+			delta   = options.Delta
+			sampler learning.Sampler
+		)
+		switch options.Sampler {
+		case "greedy":
+			if len(options.Measure) == 0 {
+				return errors.New("mis-configured measure for greedy sampler")
+			}
+			e, err := samplingMeasure(options)
+			if err != nil {
+				return err
+			}
+			scores, err := loadSamplingScores(options)
+			if err != nil {
+				return err
+			}
+
+			// Configure the sampling strategy.
+			var strategy learning.GreedyStrategy
+			switch options.Strategy {
+			case "naive":
+				strategy = learning.RankedGreedyStrategy
+			case "diversified":
+				strategy = learning.MaximalMarginalRelevanceGreedyStrategy(scores, 0.3, cui2vec.Cosine, e)
+			default:
+				return fmt.Errorf("unknown greedy sampling strategy %v", options.Strategy)
+			}
+
+			sampler = learning.NewGreedySampler(n, delta, e, m, strategy)
+		case "evaluation":
+			if len(options.Measure) == 0 {
+				return errors.New("mis-configured measure for evaluation sampler")
+			}
+			e, err := samplingMeasure(options)
+			if err != nil {
+				return err
+			}
+
+			// Configure the sampling strategy.
+			var strategy learning.ScoredStrategy
+			switch options.Strategy {
+			case "positive_biased":
+				strategy = learning.PositiveBiasScoredStrategy
+			case "negative_biased":
+				strategy = learning.NegativeBiasScoredStrategy
+			case "balanced":
+				strategy = learning.BalancedScoredStrategy
+			case "stratified":
+				strategy = learning.StratifiedScoredStrategy
+			case "diversified":
+				strategy = learning.MaximalMarginalRelevanceScoredStrategy(0.3, cui2vec.Cosine)
+			default:
+				return fmt.Errorf("unknown evaluation sampling strategy %v", options.Strategy)
+			}
+
+			scores, err := loadSamplingScores(options)
+			if err != nil {
+				return err
+			}
+
+			sampler = learning.NewEvaluationSampler(n, delta, e, m, scores, strategy)
+		case "transformation":
+			// Configure the sampling strategy.
+			var strategy learning.TransformationStrategy
+			switch options.Strategy {
+			case "stratified":
+				strategy = learning.StratifiedTransformationStrategy
+			case "balanced":
+				strategy = learning.BalancedTransformationStrategy
+			default:
+				return fmt.Errorf("unknown transformation sampling strategy %v", options.Strategy)
+			}
+
+			sampler = learning.NewTransformationSampler(n, delta, strategy)
+		case "random":
+			sampler = learning.NewRandomSampler(n, delta)
+		case "cluster":
+			if options.K == nil {
+				return errors.New("k must be specified for the cluster sampler")
+			}
+			sampler = learning.NewClusterSampler(n, delta, *options.K)
+		default:
+			return fmt.Errorf("%s is not a valid sampler", options.Sampler)
+		}
+
+		m.GenerationExplorer = learning.NewBreadthFirstExplorer(m, sampler, learning.DepthStoppingCondition(5))
+	default:
+		return fmt.Errorf("%v is not a known traversal (expected depth_first or breadth_first)", options.Traversal)
+	}
+	return nil
+}
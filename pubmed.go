@@ -0,0 +1,924 @@
+package boogie
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/stats"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// pubmedText is text that may contain markup (e.g. <i> in titles).
+type pubmedText struct {
+	Inner string `xml:",innerxml"`
+}
+
+var pubmedMarkup = regexp.MustCompile(`<[^>]*>`)
+
+func (t pubmedText) String() string {
+	return strings.TrimSpace(html.UnescapeString(pubmedMarkup.ReplaceAllString(t.Inner, "")))
+}
+
+type pubmedHeading struct {
+	Name  string `xml:",chardata"`
+	Major string `xml:"MajorTopicYN,attr"`
+}
+
+// pubmedArticle is the part of a <PubmedArticle> of the baseline that is searched and fetched.
+type pubmedArticle struct {
+	PMID    string `xml:"MedlineCitation>PMID"`
+	Article struct {
+		Journal struct {
+			Title           string `xml:"Title"`
+			ISOAbbreviation string `xml:"ISOAbbreviation"`
+			PubDate         struct {
+				Year        string `xml:"Year"`
+				Month       string `xml:"Month"`
+				Day         string `xml:"Day"`
+				MedlineDate string `xml:"MedlineDate"`
+			} `xml:"JournalIssue>PubDate"`
+		} `xml:"Journal"`
+		Title    pubmedText `xml:"ArticleTitle"`
+		Abstract []struct {
+			pubmedText
+			Label string `xml:"Label,attr"`
+		} `xml:"Abstract>AbstractText"`
+		Authors []struct {
+			LastName       string `xml:"LastName"`
+			Initials       string `xml:"Initials"`
+			CollectiveName string `xml:"CollectiveName"`
+		} `xml:"AuthorList>Author"`
+		Language         []string `xml:"Language"`
+		PublicationTypes []string `xml:"PublicationTypeList>PublicationType"`
+	} `xml:"MedlineCitation>Article"`
+	MeshHeadings []struct {
+		Descriptor pubmedHeading   `xml:"DescriptorName"`
+		Qualifiers []pubmedHeading `xml:"QualifierName"`
+	} `xml:"MedlineCitation>MeshHeadingList>MeshHeading"`
+}
+
+func (a pubmedArticle) abstract() string {
+	var paragraphs []string
+	for _, p := range a.Article.Abstract {
+		if len(p.Label) > 0 {
+			paragraphs = append(paragraphs, p.Label+": "+p.String())
+		} else {
+			paragraphs = append(paragraphs, p.String())
+		}
+	}
+	return strings.Join(paragraphs, " ")
+}
+
+// headings are the MeSH headings of the article (e.g. Myocardial Infarction/therapy), and those that are major topics.
+func (a pubmedArticle) headings() (headings, major []string) {
+	for _, h := range a.MeshHeadings {
+		heading := h.Descriptor.Name
+		isMajor := h.Descriptor.Major == "Y"
+		for _, q := range h.Qualifiers {
+			heading += "/" + q.Name
+			isMajor = isMajor || q.Major == "Y"
+		}
+		headings = append(headings, heading)
+		if isMajor {
+			major = append(major, heading)
+		}
+	}
+	return
+}
+
+func (a pubmedArticle) year() string {
+	date := a.Article.Journal.PubDate
+	if len(date.Year) > 0 {
+		return date.Year
+	}
+	if len(date.MedlineDate) >= 4 {
+		return date.MedlineDate[:4]
+	}
+	return ""
+}
+
+// document is the article as a document of a local index.
+func (a pubmedArticle) document() localDocument {
+	headings, major := a.headings()
+	title, abstract := a.Article.Title.String(), a.abstract()
+	return localDocument{
+		id: a.PMID,
+		fields: map[string]string{
+			"pmid":              a.PMID,
+			"title":             title,
+			"abstract":          abstract,
+			"text":              title + "\n" + abstract,
+			"mesh_headings":     strings.Join(headings, "\n"),
+			"mesh_major":        strings.Join(major, "\n"),
+			"publication_types": strings.Join(a.Article.PublicationTypes, "\n"),
+			"year":              a.year(),
+			// Every article is in the subset "all" (i.e. all[sb]).
+			"sb": "all",
+		},
+	}
+}
+
+// medline formats the article as a MEDLINE record, as it is fetched from PubMed with rettype=medline.
+func (a pubmedArticle) medline() string {
+	buff := new(bytes.Buffer)
+	line := func(tag, value string) {
+		if len(value) > 0 {
+			fmt.Fprintf(buff, "%-4s- %s\n", tag, value)
+		}
+	}
+	line("PMID", a.PMID)
+	date := a.Article.Journal.PubDate
+	dp := date.MedlineDate
+	if len(dp) == 0 {
+		dp = strings.TrimSpace(strings.Join([]string{date.Year, date.Month, date.Day}, " "))
+	}
+	line("DP", dp)
+	line("TI", a.Article.Title.String())
+	line("AB", a.abstract())
+	for _, author := range a.Article.Authors {
+		if len(author.CollectiveName) > 0 {
+			line("CN", author.CollectiveName)
+		} else {
+			line("AU", strings.TrimSpace(author.LastName+" "+author.Initials))
+		}
+	}
+	for _, language := range a.Article.Language {
+		line("LA", language)
+	}
+	for _, pt := range a.Article.PublicationTypes {
+		line("PT", pt)
+	}
+	line("TA", a.Article.Journal.ISOAbbreviation)
+	line("JT", a.Article.Journal.Title)
+	for _, h := range a.MeshHeadings {
+		heading := h.Descriptor.Name
+		if h.Descriptor.Major == "Y" {
+			heading = "*" + heading
+		}
+		for _, q := range h.Qualifiers {
+			if q.Major == "Y" {
+				heading += "/*" + q.Name
+			} else {
+				heading += "/" + q.Name
+			}
+		}
+		line("MH", heading)
+	}
+	// Records end with their source, as they do in PubMed, since groove does not read the last line of a record.
+	fmt.Fprintf(buff, "SO  - %s\n", strings.Trim(a.Article.Journal.ISOAbbreviation+". "+dp, ". ")+".")
+	return buff.String()
+}
+
+// pubmedIndex is the index of the articles of a store, as it is written to index.gob.
+type pubmedIndex struct {
+	// Offsets are where the XML of each article is in articles.xml.
+	Offsets map[string][2]int64
+	Index   *localIndex
+}
+
+// pubmedStore is a local store of the articles of the PubMed baseline, which answers requests to the Entrez
+// E-utilities in place of PubMed.
+type pubmedStore struct {
+	pubmedIndex
+	source   *LocalStatisticsSource
+	articles *os.File
+	// history are the results of searches and posts by WebEnv, then query_key.
+	history map[string][][]string
+	mu      sync.Mutex
+}
+
+var (
+	pubmedStores   = make(map[string]*pubmedStore)
+	pubmedStoresMu sync.Mutex
+)
+
+// readBaselineFile reads the articles and deleted citations of a baseline (or update) file, one at a time.
+func readBaselineFile(file string, article func(raw []byte, a pubmedArticle) error, deleted func(pmid string) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(file, ".gz") {
+		g, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer g.Close()
+		r = g
+	}
+
+	d := xml.NewDecoder(r)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "PubmedArticle":
+			var inner struct {
+				XML []byte `xml:",innerxml"`
+			}
+			err = d.DecodeElement(&inner, &start)
+			if err != nil {
+				return err
+			}
+			raw := append(append([]byte("<PubmedArticle>"), inner.XML...), "</PubmedArticle>"...)
+			var a pubmedArticle
+			err = xml.Unmarshal(raw, &a)
+			if err != nil {
+				return err
+			}
+			err = article(raw, a)
+			if err != nil {
+				return err
+			}
+		case "DeleteCitation":
+			var citations struct {
+				PMIDs []string `xml:"PMID"`
+			}
+			err = d.DecodeElement(&citations, &start)
+			if err != nil {
+				return err
+			}
+			for _, pmid := range citations.PMIDs {
+				err = deleted(pmid)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// buildPubMedStore ingests the baseline files into a store in the directory path. The files are read in order, and
+// each article is written to articles.xml and indexed as it is read, so that later versions of an article replace
+// earlier ones and deleted citations are removed.
+func buildPubMedStore(path string, files []string) error {
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(path, "articles.xml"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	s := pubmedIndex{
+		Offsets: make(map[string][2]int64),
+		Index:   &localIndex{Fields: make(map[string]*localField), ids: make(map[string]int)},
+	}
+	var offset int64
+	// forget removes an article that is replaced or deleted from the index. Its XML remains in articles.xml.
+	forget := func(pmid string) error {
+		at, ok := s.Offsets[pmid]
+		if !ok {
+			return nil
+		}
+		err := w.Flush()
+		if err != nil {
+			return err
+		}
+		b := make([]byte, at[1])
+		_, err = f.ReadAt(b, at[0])
+		if err != nil {
+			return err
+		}
+		var a pubmedArticle
+		err = xml.Unmarshal(b, &a)
+		if err != nil {
+			return err
+		}
+		s.Index.remove(a.document())
+		delete(s.Offsets, pmid)
+		return nil
+	}
+	for _, file := range files {
+		err = readBaselineFile(file, func(raw []byte, a pubmedArticle) error {
+			err := forget(a.PMID)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(raw)
+			if err != nil {
+				return err
+			}
+			s.Offsets[a.PMID] = [2]int64{offset, int64(len(raw))}
+			offset += int64(len(raw))
+			return s.Index.add(a.document())
+		}, forget)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	s.Index.compact()
+
+	g, err := os.Create(filepath.Join(path, "index.gob"))
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+	return gob.NewEncoder(g).Encode(s)
+}
+
+// loadPubMedStore opens the store in the directory path, ingesting the baseline files first if it does not exist or
+// any file has changed since. Stores are only read once.
+func loadPubMedStore(path string, files []string) (*pubmedStore, error) {
+	pubmedStoresMu.Lock()
+	defer pubmedStoresMu.Unlock()
+	if s, ok := pubmedStores[path]; ok {
+		return s, nil
+	}
+
+	build := len(files) > 0
+	if info, err := os.Stat(filepath.Join(path, "index.gob")); err == nil && build {
+		build = false
+		for _, file := range files {
+			f, err := os.Stat(file)
+			if err != nil {
+				return nil, err
+			}
+			build = build || f.ModTime().After(info.ModTime())
+		}
+	} else if err != nil && !build {
+		return nil, err
+	}
+	if build {
+		err := buildPubMedStore(path, files)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(filepath.Join(path, "index.gob"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := &pubmedStore{history: make(map[string][][]string)}
+	err = gob.NewDecoder(f).Decode(&s.pubmedIndex)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	s.Index.ids = make(map[string]int, len(s.Index.Documents))
+	for i, id := range s.Index.Documents {
+		s.Index.ids[id] = i
+	}
+	s.source = &LocalStatisticsSource{index: s.Index, field: "text", model: "boolean"}
+	s.articles, err = os.Open(filepath.Join(path, "articles.xml"))
+	if err != nil {
+		return nil, err
+	}
+	pubmedStores[path] = s
+	return s, nil
+}
+
+// pmidLess orders PMIDs numerically.
+func pmidLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// pubmedFields are the fields of the store searched by each PubMed field tag.
+var pubmedFields = map[string][]string{
+	"tiab":             {"title", "abstract"},
+	"title/abstract":   {"title", "abstract"},
+	"ti":               {"title"},
+	"title":            {"title"},
+	"ab":               {"abstract"},
+	"abstract":         {"abstract"},
+	"mh":               {"mesh_headings"},
+	"mesh":             {"mesh_headings"},
+	"mesh terms":       {"mesh_headings"},
+	"mh:noexp":         {"mesh_headings"},
+	"mesh:noexp":       {"mesh_headings"},
+	"mesh terms:noexp": {"mesh_headings"},
+	"majr":             {"mesh_major"},
+	"mesh major topic": {"mesh_major"},
+	"majr:noexp":       {"mesh_major"},
+	"pt":               {"publication_types"},
+	"publication type": {"publication_types"},
+	"pmid":             {"pmid"},
+	"uid":              {"pmid"},
+	"sb":               {"sb"},
+	"subset":           {"sb"},
+	"dp":               {"year"},
+	"pdat":             {"year"},
+	"publication date": {"year"},
+	"all":              {"title", "abstract", "mesh_headings", "publication_types"},
+	"all fields":       {"title", "abstract", "mesh_headings", "publication_types"},
+	"":                 {"title", "abstract", "mesh_headings", "publication_types"},
+	"text word":        {"title", "abstract", "mesh_headings", "publication_types"},
+	"tw":               {"title", "abstract", "mesh_headings", "publication_types"},
+}
+
+// pubmedToken is a term, phrase, operator, or parenthesis of a PubMed query.
+type pubmedToken struct {
+	text   string
+	tag    string
+	term   bool
+	quoted bool
+}
+
+// tokenisePubMedQuery splits a PubMed query into tokens.
+func tokenisePubMedQuery(query string) ([]pubmedToken, error) {
+	var tokens []pubmedToken
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, pubmedToken{text: string(c)})
+			i++
+		default:
+			t := pubmedToken{term: true}
+			if c == '"' {
+				end := strings.IndexByte(query[i+1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated phrase in %q", query)
+				}
+				t.text, t.quoted = query[i+1:i+1+end], true
+				i += end + 2
+				if i < len(query) && query[i] == '*' {
+					t.text += "*"
+					i++
+				}
+			} else {
+				end := strings.IndexAny(query[i:], " \t\n\r()\"[")
+				if end < 0 {
+					end = len(query) - i
+				}
+				t.text = query[i : i+end]
+				i += end
+			}
+			if i < len(query) && query[i] == '[' {
+				end := strings.IndexByte(query[i:], ']')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated field tag in %q", query)
+				}
+				t.tag = strings.ToLower(strings.TrimSpace(query[i+1 : i+end]))
+				i += end + 1
+			}
+			if !t.quoted && len(t.tag) == 0 && (t.text == "AND" || t.text == "OR" || t.text == "NOT") {
+				t.term = false
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+// pubmedParser parses the tokens of a PubMed query. Operators are evaluated from left to right, as they are by
+// PubMed, and terms without an operator between them are combined with AND.
+type pubmedParser struct {
+	tokens []pubmedToken
+	i      int
+}
+
+func (p *pubmedParser) expression() (cqr.CommonQueryRepresentation, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		operator string
+		children = []cqr.CommonQueryRepresentation{left}
+	)
+	for p.i < len(p.tokens) && p.tokens[p.i].text != ")" {
+		o := cqr.AND
+		if t := p.tokens[p.i]; !t.term && t.text != "(" {
+			o = strings.ToLower(t.text)
+			p.i++
+		}
+		right, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		if len(operator) == 0 || o == operator {
+			operator = o
+			children = append(children, right)
+		} else {
+			children = []cqr.CommonQueryRepresentation{cqr.BooleanQuery{Operator: operator, Children: children}, right}
+			operator = o
+		}
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return cqr.BooleanQuery{Operator: operator, Children: children}, nil
+}
+
+func (p *pubmedParser) primary() (cqr.CommonQueryRepresentation, error) {
+	if p.i >= len(p.tokens) {
+		return nil, fmt.Errorf("the query ends where a term was expected")
+	}
+	t := p.tokens[p.i]
+	p.i++
+	switch {
+	case t.text == "(":
+		q, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.i >= len(p.tokens) || p.tokens[p.i].text != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.i++
+		return q, nil
+	case t.term:
+		return pubmedTerm(t)
+	}
+	return nil, fmt.Errorf("unexpected %s", t.text)
+}
+
+// pubmedTerm converts a term of a PubMed query into a keyword. Publication dates are matched by year, including
+// ranges (e.g. 2010:2015[dp]).
+func pubmedTerm(t pubmedToken) (cqr.CommonQueryRepresentation, error) {
+	fields, ok := pubmedFields[t.tag]
+	if !ok {
+		return nil, fmt.Errorf("the field [%s] is not supported by the pubmed baseline", t.tag)
+	}
+	if fields[0] != "year" {
+		return cqr.Keyword{QueryString: t.text, Fields: fields}, nil
+	}
+
+	bounds := strings.SplitN(t.text, ":", 2)
+	from, err := pubmedYear(bounds[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s[%s] is not a year", t.text, t.tag)
+	}
+	to := from
+	if len(bounds) == 2 {
+		to, err = pubmedYear(bounds[1])
+		if err != nil || to < from {
+			return nil, fmt.Errorf("%s[%s] is not a range of years", t.text, t.tag)
+		}
+	}
+	years := cqr.BooleanQuery{Operator: cqr.OR}
+	for year := from; year <= to; year++ {
+		years.Children = append(years.Children, cqr.Keyword{QueryString: strconv.Itoa(year), Fields: fields})
+	}
+	return years, nil
+}
+
+// pubmedYear is the year of a date (e.g. 2015 or 2015/01/01).
+func pubmedYear(date string) (int, error) {
+	date = strings.TrimSpace(date)
+	if len(date) > 4 {
+		date = date[:4]
+	}
+	return strconv.Atoi(date)
+}
+
+// ParsePubMedQuery parses a query in the PubMed search syntax into a Boolean query of the fields of the PubMed
+// baseline source.
+func ParsePubMedQuery(query string) (cqr.CommonQueryRepresentation, error) {
+	tokens, err := tokenisePubMedQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("the query is empty")
+	}
+	p := &pubmedParser{tokens: tokens}
+	q, err := p.expression()
+	if err != nil {
+		return nil, fmt.Errorf("%v in %q", err, query)
+	}
+	if p.i < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected ) in %q", query)
+	}
+	return q, nil
+}
+
+// search finds the PMIDs of the articles matching a PubMed query, most recent (i.e. highest PMID) first.
+func (s *pubmedStore) search(term string) ([]string, error) {
+	q, err := ParsePubMedQuery(term)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.source.match(q, nil)
+	if err != nil {
+		return nil, err
+	}
+	pmids := make([]string, 0, len(docs))
+	for doc := range docs {
+		pmids = append(pmids, s.Index.Documents[doc])
+	}
+	sort.Slice(pmids, func(i, j int) bool {
+		return pmidLess(pmids[j], pmids[i])
+	})
+	return pmids, nil
+}
+
+// article reads the XML of an article.
+func (s *pubmedStore) article(pmid string) ([]byte, error) {
+	offset, ok := s.Offsets[pmid]
+	if !ok {
+		return nil, nil
+	}
+	b := make([]byte, offset[1])
+	_, err := s.articles.ReadAt(b, offset[0])
+	return b, err
+}
+
+// remember adds PMIDs to the history of a WebEnv (creating it if it is empty), returning the WebEnv and query_key.
+func (s *pubmedStore) remember(webEnv string, pmids []string) (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.history[webEnv]; !ok || len(webEnv) == 0 {
+		webEnv = fmt.Sprintf("BOOGIE_%d", len(s.history)+1)
+	}
+	s.history[webEnv] = append(s.history[webEnv], pmids)
+	return webEnv, len(s.history[webEnv])
+}
+
+// recall finds the PMIDs of a query_key of a WebEnv.
+func (s *pubmedStore) recall(webEnv, queryKey string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := strconv.Atoi(queryKey)
+	if err != nil || key < 1 || key > len(s.history[webEnv]) {
+		return nil, fmt.Errorf("no results for the WebEnv %s and query_key %s", webEnv, queryKey)
+	}
+	return s.history[webEnv][key-1], nil
+}
+
+// page is the part of a list of PMIDs between retstart and retmax.
+func page(pmids []string, values url.Values, size int) ([]string, int, int) {
+	start, err := strconv.Atoi(values.Get("retstart"))
+	if err != nil || start < 0 {
+		start = 0
+	}
+	retmax, err := strconv.Atoi(values.Get("retmax"))
+	if err != nil || retmax < 0 {
+		retmax = size
+	}
+	if start > len(pmids) {
+		start = len(pmids)
+	}
+	end := start + retmax
+	if end > len(pmids) {
+		end = len(pmids)
+	}
+	return pmids[start:end], start, end - start
+}
+
+func xmlResponse(req *http.Request, body string) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/xml; charset=UTF-8"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func xmlEscape(s string) string {
+	buff := new(bytes.Buffer)
+	xml.EscapeText(buff, []byte(s))
+	return buff.String()
+}
+
+// RoundTrip answers the esearch, efetch, einfo, and epost requests of the Entrez E-utilities for PubMed. Requests
+// that cannot be answered from the store are errors, so that they are never silently sent to PubMed.
+func (s *pubmedStore) RoundTrip(req *http.Request) (*http.Response, error) {
+	values := req.URL.Query()
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		form, err := url.ParseQuery(string(b))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range form {
+			values[k] = append(values[k], v...)
+		}
+	}
+	utility := strings.TrimSuffix(filepath.Base(req.URL.Path), ".fcgi")
+	if db := values.Get("db"); db != "pubmed" && !(utility == "einfo" && len(db) == 0) {
+		return nil, fmt.Errorf("the pubmed baseline cannot answer %s requests for the database %q", utility, db)
+	}
+
+	var pmids []string
+	if len(values.Get("query_key")) > 0 {
+		var err error
+		pmids, err = s.recall(values.Get("WebEnv"), values.Get("query_key"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(values.Get("id")) > 0 {
+		for _, id := range values["id"] {
+			for _, pmid := range strings.Split(id, ",") {
+				if pmid = strings.TrimSpace(pmid); len(pmid) > 0 {
+					pmids = append(pmids, pmid)
+				}
+			}
+		}
+	}
+
+	buff := new(bytes.Buffer)
+	buff.WriteString(`<?xml version="1.0" encoding="UTF-8" ?>` + "\n")
+	switch utility {
+	case "einfo":
+		if len(values.Get("db")) == 0 {
+			buff.WriteString("<eInfoResult><DbList><DbName>pubmed</DbName></DbList></eInfoResult>\n")
+			break
+		}
+		fmt.Fprintf(buff, "<eInfoResult><DbInfo><DbName>pubmed</DbName><MenuName>PubMed</MenuName><Description>PubMed baseline</Description><Count>%d</Count></DbInfo></eInfoResult>\n", len(s.Index.Documents))
+	case "esearch":
+		term := values.Get("term")
+		results, err := s.search(term)
+		if err != nil {
+			return nil, err
+		}
+		ids, start, retmax := page(results, values, 20)
+		var (
+			webEnv  string
+			key     int
+			count   = values.Get("rettype") == "count"
+			history = !count && strings.ToLower(values.Get("usehistory")) == "y"
+		)
+		if history {
+			webEnv, key = s.remember(values.Get("WebEnv"), results)
+		}
+
+		// groove searches with retmode=json.
+		if values.Get("retmode") == "json" {
+			result := map[string]interface{}{"count": strconv.Itoa(len(results))}
+			if !count {
+				result["retmax"] = strconv.Itoa(retmax)
+				result["retstart"] = strconv.Itoa(start)
+				result["idlist"] = append([]string{}, ids...)
+				result["querytranslation"] = term
+			}
+			if history {
+				result["querykey"] = strconv.Itoa(key)
+				result["webenv"] = webEnv
+			}
+			b, err := json.Marshal(map[string]interface{}{
+				"header":        map[string]string{"type": "esearch", "version": "0.3"},
+				"esearchresult": result,
+			})
+			if err != nil {
+				return nil, err
+			}
+			resp := xmlResponse(req, string(b))
+			resp.Header.Set("Content-Type", "application/json; charset=UTF-8")
+			return resp, nil
+		}
+
+		buff.WriteString("<eSearchResult>")
+		fmt.Fprintf(buff, "<Count>%d</Count>", len(results))
+		if !count {
+			fmt.Fprintf(buff, "<RetMax>%d</RetMax><RetStart>%d</RetStart>", retmax, start)
+			if history {
+				fmt.Fprintf(buff, "<QueryKey>%d</QueryKey><WebEnv>%s</WebEnv>", key, xmlEscape(webEnv))
+			}
+			buff.WriteString("<IdList>")
+			for _, id := range ids {
+				fmt.Fprintf(buff, "<Id>%s</Id>", id)
+			}
+			buff.WriteString("</IdList><TranslationSet/>")
+			fmt.Fprintf(buff, "<QueryTranslation>%s</QueryTranslation>", xmlEscape(term))
+		}
+		buff.WriteString("</eSearchResult>\n")
+	case "epost":
+		webEnv, key := s.remember(values.Get("WebEnv"), pmids)
+		fmt.Fprintf(buff, "<ePostResult><QueryKey>%d</QueryKey><WebEnv>%s</WebEnv></ePostResult>\n", key, xmlEscape(webEnv))
+	case "efetch":
+		if len(values.Get("query_key")) > 0 {
+			pmids, _, _ = page(pmids, values, len(pmids))
+		}
+		medline := values.Get("rettype") == "medline"
+		if medline {
+			buff.Reset()
+		} else {
+			buff.WriteString("<PubmedArticleSet>\n")
+		}
+		for _, pmid := range pmids {
+			b, err := s.article(pmid)
+			if err != nil {
+				return nil, err
+			}
+			if b == nil {
+				continue
+			}
+			if !medline {
+				buff.Write(b)
+				buff.WriteString("\n")
+				continue
+			}
+			var a pubmedArticle
+			err = xml.Unmarshal(b, &a)
+			if err != nil {
+				return nil, err
+			}
+			// Records are separated by a blank line.
+			if buff.Len() > 0 {
+				buff.WriteString("\n")
+			}
+			buff.WriteString(a.medline())
+		}
+		if !medline {
+			buff.WriteString("</PubmedArticleSet>\n")
+		}
+		resp := xmlResponse(req, buff.String())
+		if medline {
+			resp.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+		}
+		return resp, nil
+	default:
+		return nil, fmt.Errorf("the pubmed baseline cannot answer %s requests", utility)
+	}
+	return xmlResponse(req, buff.String()), nil
+}
+
+// NewPubMedBaselineStatisticsSource creates an Entrez statistics source whose requests are answered by a local store of
+// the PubMed baseline instead of PubMed, so that it can be used wherever the entrez source is (e.g. by the dt and
+// objective formulators) without access to the network.
+func NewPubMedBaselineStatisticsSource(config map[string]interface{}) (stats.EntrezStatisticsSource, error) {
+	var options PubMedBaselineOptions
+	err := decodeOptions("pubmed_baseline", config, &options)
+	if err != nil {
+		return stats.EntrezStatisticsSource{}, err
+	}
+	if len(options.Store) == 0 {
+		return stats.EntrezStatisticsSource{}, fmt.Errorf("the store of the pubmed_baseline source must be specified")
+	}
+
+	var files []string
+	for _, pattern := range options.Baseline {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return stats.EntrezStatisticsSource{}, err
+		}
+		if len(matches) == 0 {
+			return stats.EntrezStatisticsSource{}, fmt.Errorf("no baseline files match %s", pattern)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	store, err := loadPubMedStore(options.Store, files)
+	if err != nil {
+		return stats.EntrezStatisticsSource{}, err
+	}
+
+	// Only the requests of this source are answered by the store, as they are made by a tool of the store.
+	abs, err := filepath.Abs(options.Store)
+	if err != nil {
+		return stats.EntrezStatisticsSource{}, err
+	}
+	h := sha256.Sum256([]byte(abs))
+	tool := "boogie_pubmed_baseline_" + hex.EncodeToString(h[:8])
+	useLocalEntrez(tool, store)
+
+	return stats.NewEntrezStatisticsSource(
+		stats.EntrezEmail("boogie@localhost"),
+		stats.EntrezTool(tool),
+		stats.EntrezOptions(options.Search.searchOptions()),
+		stats.EntrezRank(options.Rank))
+}
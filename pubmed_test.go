@@ -0,0 +1,245 @@
+package boogie
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/hscells/cqr"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePubMedQuery(t *testing.T) {
+	all := pubmedFields["all"]
+	tiab := []string{"title", "abstract"}
+	for _, test := range []struct {
+		query string
+		want  cqr.CommonQueryRepresentation
+	}{
+		{"heart", cqr.Keyword{QueryString: "heart", Fields: all}},
+		// A field tag applies to the term before it, and terms without an operator between them are combined with AND.
+		{"heart attack[tiab]", cqr.BooleanQuery{Operator: cqr.AND, Children: []cqr.CommonQueryRepresentation{
+			cqr.Keyword{QueryString: "heart", Fields: all},
+			cqr.Keyword{QueryString: "attack", Fields: tiab},
+		}}},
+		{`"heart attack"[Title] OR aspirin[mh]`, cqr.BooleanQuery{Operator: cqr.OR, Children: []cqr.CommonQueryRepresentation{
+			cqr.Keyword{QueryString: "heart attack", Fields: []string{"title"}},
+			cqr.Keyword{QueryString: "aspirin", Fields: []string{"mesh_headings"}},
+		}}},
+		{`"heart attack"*[tiab]`, cqr.Keyword{QueryString: "heart attack*", Fields: tiab}},
+		// Operators are evaluated from left to right.
+		{"a OR b AND c", cqr.BooleanQuery{Operator: cqr.AND, Children: []cqr.CommonQueryRepresentation{
+			cqr.BooleanQuery{Operator: cqr.OR, Children: []cqr.CommonQueryRepresentation{
+				cqr.Keyword{QueryString: "a", Fields: all},
+				cqr.Keyword{QueryString: "b", Fields: all},
+			}},
+			cqr.Keyword{QueryString: "c", Fields: all},
+		}}},
+		{"a OR (b NOT c)", cqr.BooleanQuery{Operator: cqr.OR, Children: []cqr.CommonQueryRepresentation{
+			cqr.Keyword{QueryString: "a", Fields: all},
+			cqr.BooleanQuery{Operator: cqr.NOT, Children: []cqr.CommonQueryRepresentation{
+				cqr.Keyword{QueryString: "b", Fields: all},
+				cqr.Keyword{QueryString: "c", Fields: all},
+			}},
+		}}},
+		// Operators with a field tag are terms.
+		{"AND[ti]", cqr.Keyword{QueryString: "AND", Fields: []string{"title"}}},
+		{"2010/01:2012[dp]", cqr.BooleanQuery{Operator: cqr.OR, Children: []cqr.CommonQueryRepresentation{
+			cqr.Keyword{QueryString: "2010", Fields: []string{"year"}},
+			cqr.Keyword{QueryString: "2011", Fields: []string{"year"}},
+			cqr.Keyword{QueryString: "2012", Fields: []string{"year"}},
+		}}},
+	} {
+		got, err := ParsePubMedQuery(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s = %#v, want %#v", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"", "(heart", "heart)", `"heart`, "heart[ti", "heart[xx]", "heart AND", "2012:2010[dp]", "x[dp]"} {
+		_, err := ParsePubMedQuery(query)
+		if err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+const testPubMedBaseline = `<?xml version="1.0" encoding="utf-8"?>
+<PubmedArticleSet>
+<PubmedArticle><MedlineCitation><PMID>1</PMID><Article><Journal><JournalIssue><PubDate><Year>2012</Year></PubDate></JournalIssue></Journal><ArticleTitle>Heart of the matter</ArticleTitle></Article></MedlineCitation></PubmedArticle>
+<PubmedArticle><MedlineCitation><PMID>2</PMID><Article><Journal><JournalIssue><PubDate><Year>2010</Year></PubDate></JournalIssue></Journal><ArticleTitle>Heart failure</ArticleTitle></Article></MedlineCitation></PubmedArticle>
+<PubmedArticle><MedlineCitation><PMID>3</PMID><Article><Journal><JournalIssue><PubDate><MedlineDate>2012 Jan-Feb</MedlineDate></PubDate></JournalIssue></Journal><ArticleTitle>Lung cancer</ArticleTitle></Article></MedlineCitation></PubmedArticle>
+<PubmedArticle><MedlineCitation><PMID>10</PMID><Article><Journal><Title>The Heart Journal</Title><ISOAbbreviation>Heart J</ISOAbbreviation><JournalIssue><PubDate><Year>2015</Year><Month>Jan</Month></PubDate></JournalIssue></Journal><ArticleTitle>Aspirin after a <i>heart</i> attack</ArticleTitle><Abstract><AbstractText Label="BACKGROUND">Aspirin &amp; statins.</AbstractText><AbstractText Label="RESULTS">Fewer deaths.</AbstractText></Abstract><AuthorList><Author><LastName>Smith</LastName><Initials>J</Initials></Author><Author><CollectiveName>Heart Group</CollectiveName></Author></AuthorList><Language>eng</Language><PublicationTypeList><PublicationType>Randomized Controlled Trial</PublicationType></PublicationTypeList></Article><MeshHeadingList><MeshHeading><DescriptorName MajorTopicYN="Y">Myocardial Infarction</DescriptorName><QualifierName MajorTopicYN="N">drug therapy</QualifierName></MeshHeading><MeshHeading><DescriptorName MajorTopicYN="N">Aspirin</DescriptorName><QualifierName MajorTopicYN="Y">therapeutic use</QualifierName></MeshHeading></MeshHeadingList></MedlineCitation></PubmedArticle>
+</PubmedArticleSet>
+`
+
+const testPubMedUpdate = `<?xml version="1.0" encoding="utf-8"?>
+<PubmedArticleSet><DeleteCitation><PMID>1</PMID></DeleteCitation></PubmedArticleSet>
+`
+
+// testPubMedSearch is the part of an esearch result that is tested.
+type testPubMedSearch struct {
+	Count    int      `xml:"Count"`
+	RetMax   int      `xml:"RetMax"`
+	RetStart int      `xml:"RetStart"`
+	QueryKey int      `xml:"QueryKey"`
+	WebEnv   string   `xml:"WebEnv"`
+	IDs      []string `xml:"IdList>Id"`
+}
+
+func TestPubMedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boogie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var files []string
+	for i, baseline := range []string{testPubMedBaseline, testPubMedUpdate} {
+		file := filepath.Join(dir, []string{"pubmed0001.xml", "pubmed0002.xml"}[i])
+		err = ioutil.WriteFile(file, []byte(baseline), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	s, err := loadPubMedStore(filepath.Join(dir, "store"), files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(utility string, values url.Values) (string, error) {
+		req, err := http.NewRequest(http.MethodGet, "https://"+entrezHost+"/entrez/eutils/"+utility+".fcgi?"+values.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := s.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return string(b), err
+	}
+	search := func(values url.Values) testPubMedSearch {
+		t.Helper()
+		b, err := request("esearch", values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r testPubMedSearch
+		err = xml.Unmarshal([]byte(b), &r)
+		if err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		return r
+	}
+
+	// The deleted article is not found, and the most recent article is first.
+	r := search(url.Values{"db": {"pubmed"}, "term": {"heart[tiab]"}, "retmax": {"1"}, "usehistory": {"y"}})
+	if want := (testPubMedSearch{Count: 2, RetMax: 1, QueryKey: 1, WebEnv: "BOOGIE_1", IDs: []string{"10"}}); !reflect.DeepEqual(r, want) {
+		t.Errorf("first page = %+v, want %+v", r, want)
+	}
+	r = search(url.Values{"db": {"pubmed"}, "term": {"heart[tiab]"}, "retstart": {"1"}, "retmax": {"1"}})
+	if want := (testPubMedSearch{Count: 2, RetMax: 1, RetStart: 1, IDs: []string{"2"}}); !reflect.DeepEqual(r, want) {
+		t.Errorf("second page = %+v, want %+v", r, want)
+	}
+	r = search(url.Values{"db": {"pubmed"}, "term": {"2010:2012[dp]"}})
+	if want := (testPubMedSearch{Count: 2, RetMax: 2, IDs: []string{"3", "2"}}); !reflect.DeepEqual(r, want) {
+		t.Errorf("dates = %+v, want %+v", r, want)
+	}
+
+	b, err := request("esearch", url.Values{"db": {"pubmed"}, "term": {"heart[tiab]"}, "rettype": {"count"}, "retmode": {"json"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count struct {
+		Result map[string]interface{} `json:"esearchresult"`
+	}
+	err = json.Unmarshal([]byte(b), &count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"count": "2"}; !reflect.DeepEqual(count.Result, want) {
+		t.Errorf("json count = %v, want %v", count.Result, want)
+	}
+
+	// Posted PMIDs are added to the history of the WebEnv, and pages of the history can be fetched.
+	b, err = request("epost", url.Values{"db": {"pubmed"}, "id": {"3,10"}, "WebEnv": {"BOOGIE_1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b, "<QueryKey>2</QueryKey><WebEnv>BOOGIE_1</WebEnv>") {
+		t.Errorf("epost = %s", b)
+	}
+	for _, test := range []struct {
+		key, retstart string
+		want          []string
+	}{
+		{"1", "1", []string{"2"}},
+		{"2", "0", []string{"3"}},
+	} {
+		b, err = request("efetch", url.Values{"db": {"pubmed"}, "WebEnv": {"BOOGIE_1"}, "query_key": {test.key}, "retstart": {test.retstart}, "retmax": {"1"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var set struct {
+			Articles []pubmedArticle `xml:"PubmedArticle"`
+		}
+		err = xml.Unmarshal([]byte(b), &set)
+		if err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		var pmids []string
+		for _, a := range set.Articles {
+			pmids = append(pmids, a.PMID)
+		}
+		if !reflect.DeepEqual(pmids, test.want) {
+			t.Errorf("efetch of query_key %s = %v, want %v", test.key, pmids, test.want)
+		}
+	}
+	_, err = request("efetch", url.Values{"db": {"pubmed"}, "WebEnv": {"BOOGIE_1"}, "query_key": {"3"}})
+	if err == nil {
+		t.Error("expected an error for an unknown query_key")
+	}
+
+	b, err = request("efetch", url.Values{"db": {"pubmed"}, "id": {"10,1,3"}, "rettype": {"medline"}, "retmode": {"text"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `PMID- 10
+DP  - 2015 Jan
+TI  - Aspirin after a heart attack
+AB  - BACKGROUND: Aspirin & statins. RESULTS: Fewer deaths.
+AU  - Smith J
+CN  - Heart Group
+LA  - eng
+PT  - Randomized Controlled Trial
+TA  - Heart J
+JT  - The Heart Journal
+MH  - *Myocardial Infarction/drug therapy
+MH  - Aspirin/*therapeutic use
+SO  - Heart J. 2015 Jan.
+
+PMID- 3
+DP  - 2012 Jan-Feb
+TI  - Lung cancer
+SO  - 2012 Jan-Feb.
+`
+	if b != want {
+		t.Errorf("medline =\n%s\nwant\n%s", b, want)
+	}
+
+	_, err = request("esearch", url.Values{"db": {"nucleotide"}, "term": {"heart"}})
+	if err == nil {
+		t.Error("expected an error for another database")
+	}
+}
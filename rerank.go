@@ -0,0 +1,176 @@
+package boogie
+
+import (
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Scorer scores a document retrieved for a query, so that the documents retrieved by a statistics source can be
+// re-ranked.
+type Scorer interface {
+	Score(query cqr.CommonQueryRepresentation, docId string, fields ...string) (float64, error)
+}
+
+// statisticsScorer is implemented by scorers that score documents with the statistics source being re-ranked.
+type statisticsScorer interface {
+	// rank prepares the scorer to score the documents retrieved for a query by a statistics source.
+	rank(ss stats.StatisticsSource, docIds []string, fields []string) (Scorer, error)
+}
+
+// Reranker re-ranks the run of a topic with a scorer once it has been retrieved, so that the re-ranked run is the one
+// output to trec results and evaluated. Documents are scored using the statistics source that retrieved them.
+type Reranker struct {
+	Source stats.StatisticsSource
+	Scorer Scorer
+	Fields []string
+}
+
+// Rerank scores each document of a run for a query, and orders the run by score. Documents with the same score keep
+// their order in the run.
+func (r Reranker) Rerank(query cqr.CommonQueryRepresentation, results trecresults.ResultList) (trecresults.ResultList, error) {
+	var err error
+	scorer := r.Scorer
+	if s, ok := scorer.(statisticsScorer); ok {
+		docIds := make([]string, len(results))
+		for i, result := range results {
+			docIds[i] = result.DocId
+		}
+		scorer, err = s.rank(r.Source, docIds, r.Fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, result := range results {
+		result.Score, err = scorer.Score(query, result.DocId, r.Fields...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	for i, result := range results {
+		result.Rank = int64(i + 1)
+	}
+	return results, nil
+}
+
+// Scoring functions of the term vector scorer.
+const (
+	ScorerBM25  = "bm25"
+	ScorerTFIDF = "tfidf"
+)
+
+// TermVectorScorer scores documents with BM25 or TF-IDF, using the term vectors of the documents retrieved by the
+// statistics source being re-ranked. The terms of queries are matched to the terms of documents as they were indexed,
+// and each field is scored separately. The average document length of BM25 is that of the documents being re-ranked.
+type TermVectorScorer struct {
+	Model string
+	K1, B float64
+
+	// vectors are the term vectors of the documents being re-ranked, and n the number of documents in the collection.
+	vectors map[string]stats.TermVector
+	avgdl   map[string]float64
+	n       float64
+}
+
+func (s TermVectorScorer) rank(ss stats.StatisticsSource, docIds []string, fields []string) (Scorer, error) {
+	n, err := ss.CollectionSize()
+	if err != nil {
+		return nil, err
+	}
+	s.n = n
+	s.vectors = make(map[string]stats.TermVector, len(docIds))
+	s.avgdl = make(map[string]float64)
+	for _, docId := range docIds {
+		tv, err := ss.TermVector(docId)
+		if err != nil {
+			return nil, err
+		}
+		s.vectors[docId] = tv
+		for _, t := range tv {
+			s.avgdl[t.Field] += t.TermFrequency
+		}
+	}
+	for field := range s.avgdl {
+		s.avgdl[field] /= float64(len(docIds))
+	}
+	return s, nil
+}
+
+// Score scores a document on fields, or every field of the document if none are given.
+func (s TermVectorScorer) Score(query cqr.CommonQueryRepresentation, docId string, fields ...string) (float64, error) {
+	if s.vectors == nil {
+		return 0, fmt.Errorf("the %s scorer can only score the documents of a statistics source", s.Model)
+	}
+	terms := make(map[string]float64)
+	for _, keyword := range queryKeywords(query) {
+		for _, term := range strings.Fields(strings.ToLower(keyword)) {
+			terms[strings.Trim(term, `"*`)]++
+		}
+	}
+	scored := make(map[string]bool)
+	for _, field := range fields {
+		scored[field] = true
+	}
+
+	tv := s.vectors[docId]
+	length := make(map[string]float64)
+	for _, t := range tv {
+		length[t.Field] += t.TermFrequency
+	}
+
+	var score float64
+	for _, t := range tv {
+		qtf, ok := terms[t.Term]
+		if !ok || (len(fields) > 0 && !scored[t.Field]) || t.DocumentFrequency == 0 {
+			continue
+		}
+		tf, df := t.TermFrequency, t.DocumentFrequency
+		switch s.Model {
+		case ScorerBM25:
+			idf := math.Log(1 + (s.n-df+0.5)/(df+0.5))
+			score += qtf * idf * (tf * (s.K1 + 1)) / (tf + s.K1*(1-s.B+s.B*length[t.Field]/s.avgdl[t.Field]))
+		case ScorerTFIDF:
+			score += qtf * tf * math.Log(s.n/df)
+		}
+	}
+	return score, nil
+}
+
+// NewScorer creates a scorer from the `scorer` and `scorer_options` sections of the DSL.
+func NewScorer(name string, options map[string]interface{}) (Scorer, error) {
+	var o ScorerOptions
+	err := decodeOptions("scorer", options, &o)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case ScorerBM25:
+		k1, b := 1.2, 0.75
+		if o.K1 != nil {
+			k1 = *o.K1
+		}
+		if o.B != nil {
+			b = *o.B
+		}
+		return TermVectorScorer{Model: name, K1: k1, B: b}, nil
+	case ScorerTFIDF:
+		return TermVectorScorer{Model: name}, nil
+	}
+	return nil, fmt.Errorf("%v is not a known scorer", name)
+}
+
+// scorerFields extracts the fields scoring is performed on from the scorer options.
+func scorerFields(options map[string]interface{}) ([]string, error) {
+	var o ScorerOptions
+	err := decodeOptions("scorer", options, &o)
+	return o.Fields, err
+}
@@ -0,0 +1,46 @@
+package boogie
+
+import (
+	"github.com/hscells/cqr"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testIDScorer scores documents by their id, so that re-ranking orders a run by descending id.
+type testIDScorer struct{}
+
+func (testIDScorer) Score(query cqr.CommonQueryRepresentation, docId string, fields ...string) (float64, error) {
+	return strconv.ParseFloat(docId, 64)
+}
+
+func TestRunRerank(t *testing.T) {
+	RegisterScorer("test_id", testIDScorer{})
+	tests := []struct {
+		name   string
+		scorer string
+		want   []string
+	}{
+		{"retrieved", "", []string{"1", "2", "4"}},
+		{"re-ranked", "test_id", []string{"4", "2", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsl, _, cleanup := newTestPipeline(t, map[string]string{"1": "heart"})
+			defer cleanup()
+			dsl.Scorer = tt.scorer
+
+			r, err := NewRun(dsl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = r.Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readTestRun(t, dsl.Output.Trec.Output)["1"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("run of topic 1 = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package boogie
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+)
+
+// Names of the aggregate rows added to evaluations.
+const (
+	AggregateMean   = "mean"
+	AggregateMedian = "median"
+	AggregateStdDev = "std"
+)
+
+var aggregateTopics = []string{AggregateMean, AggregateMedian, AggregateStdDev}
+
+func isAggregateTopic(topic string) bool {
+	for _, t := range aggregateTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// AggregateEvaluations computes the mean, median and (sample) standard deviation of each measure over all topics.
+// The results are keyed by the aggregate (i.e. AggregateMean), so they can be added to evaluations as extra rows.
+func AggregateEvaluations(evaluations map[string]map[string]float64) map[string]map[string]float64 {
+	values := make(map[string][]float64)
+	for topic, results := range evaluations {
+		if isAggregateTopic(topic) {
+			continue
+		}
+		for measure, v := range results {
+			values[measure] = append(values[measure], v)
+		}
+	}
+
+	aggregates := map[string]map[string]float64{
+		AggregateMean:   {},
+		AggregateMedian: {},
+		AggregateStdDev: {},
+	}
+	for measure, v := range values {
+		aggregates[AggregateMean][measure] = mean(v)
+		aggregates[AggregateMedian][measure] = median(v)
+		aggregates[AggregateStdDev][measure] = stdDev(v)
+	}
+	return aggregates
+}
+
+// Significance is the comparison of a measure between a run and a baseline over the topics in both.
+type Significance struct {
+	Topics       int     `json:"topics"`
+	Mean         float64 `json:"mean"`
+	BaselineMean float64 `json:"baseline_mean"`
+	Wins         int     `json:"wins"`
+	Ties         int     `json:"ties"`
+	Losses       int     `json:"losses"`
+	TTest        float64 `json:"t_test_p"`
+	Wilcoxon     float64 `json:"wilcoxon_p"`
+}
+
+// LoadEvaluations reads evaluations from a file in the json evaluation format.
+func LoadEvaluations(path string) (map[string]map[string]float64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var evaluations map[string]map[string]float64
+	err = json.Unmarshal(b, &evaluations)
+	return evaluations, err
+}
+
+// CompareEvaluations computes, for each measure, the number of topics that win, tie, or lose against the baseline,
+// and the p-values of a two-sided paired t-test and Wilcoxon signed-rank test.
+func CompareEvaluations(evaluations, baseline map[string]map[string]float64) map[string]Significance {
+	x := make(map[string][]float64)
+	y := make(map[string][]float64)
+
+	topics := make([]string, 0, len(evaluations))
+	for topic := range evaluations {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	for _, topic := range topics {
+		if isAggregateTopic(topic) {
+			continue
+		}
+		b, ok := baseline[topic]
+		if !ok {
+			continue
+		}
+		for measure, v := range evaluations[topic] {
+			if bv, ok := b[measure]; ok {
+				x[measure] = append(x[measure], v)
+				y[measure] = append(y[measure], bv)
+			}
+		}
+	}
+
+	comparison := make(map[string]Significance)
+	for measure := range x {
+		s := Significance{
+			Topics:       len(x[measure]),
+			Mean:         mean(x[measure]),
+			BaselineMean: mean(y[measure]),
+			TTest:        pairedTTest(x[measure], y[measure]),
+			Wilcoxon:     wilcoxonSignedRank(x[measure], y[measure]),
+		}
+		for i := range x[measure] {
+			switch {
+			case x[measure][i] > y[measure][i]:
+				s.Wins++
+			case x[measure][i] < y[measure][i]:
+				s.Losses++
+			default:
+				s.Ties++
+			}
+		}
+		comparison[measure] = s
+	}
+	return comparison
+}
+
+func mean(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range x {
+		sum += v
+	}
+	return sum / float64(len(x))
+}
+
+func median(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	s := append([]float64{}, x...)
+	sort.Float64s(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+func stdDev(x []float64) float64 {
+	if len(x) < 2 {
+		return 0
+	}
+	m := mean(x)
+	var ss float64
+	for _, v := range x {
+		ss += (v - m) * (v - m)
+	}
+	return math.Sqrt(ss / float64(len(x)-1))
+}
+
+// pairedTTest computes the two-sided p-value of a paired t-test.
+func pairedTTest(x, y []float64) float64 {
+	n := len(x)
+	if n < 2 {
+		return 1
+	}
+	d := make([]float64, n)
+	for i := range x {
+		d[i] = x[i] - y[i]
+	}
+	sd := stdDev(d)
+	if sd == 0 {
+		if mean(d) == 0 {
+			return 1
+		}
+		return 0
+	}
+	t := mean(d) / (sd / math.Sqrt(float64(n)))
+	df := float64(n - 1)
+	// The two-sided p-value of Student's t distribution, via the regularised incomplete beta function.
+	return incompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// wilcoxonSignedRank computes the two-sided p-value of a Wilcoxon signed-rank test, using the normal approximation
+// with corrections for ties and continuity. Pairs with no difference are discarded.
+func wilcoxonSignedRank(x, y []float64) float64 {
+	var d []float64
+	for i := range x {
+		if x[i] != y[i] {
+			d = append(d, x[i]-y[i])
+		}
+	}
+	n := len(d)
+	if n == 0 {
+		return 1
+	}
+	sort.Slice(d, func(i, j int) bool {
+		return math.Abs(d[i]) < math.Abs(d[j])
+	})
+
+	// Assign average ranks to tied absolute differences.
+	var w, tieCorrection float64
+	for i := 0; i < n; {
+		j := i
+		for j < n && math.Abs(d[j]) == math.Abs(d[i]) {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if d[k] > 0 {
+				w += rank
+			}
+		}
+		t := float64(j - i)
+		tieCorrection += t*t*t - t
+		i = j
+	}
+
+	nf := float64(n)
+	mu := nf * (nf + 1) / 4
+	sigma := math.Sqrt(nf*(nf+1)*(2*nf+1)/24 - tieCorrection/48)
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(w-mu) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// incompleteBeta computes the regularised incomplete beta function I_x(a, b).
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete beta function (Lentz's method).
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 3e-14
+		tiny          = 1e-300
+	)
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		mf := float64(m)
+		aa := mf * (b - mf) * x / ((a + 2*mf - 1) * (a + 2*mf))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + mf) * (a + b + mf) * x / ((a + 2*mf) * (a + 2*mf + 1))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
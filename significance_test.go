@@ -0,0 +1,163 @@
+package boogie
+
+import (
+	"math"
+	"testing"
+)
+
+// The x and y of the paired example in the documentation of R's wilcox.test.
+var (
+	testSignificanceX = []float64{1.83, 0.50, 1.62, 2.48, 1.68, 1.88, 1.55, 3.06, 1.30}
+	testSignificanceY = []float64{0.878, 0.647, 0.598, 2.05, 1.06, 1.29, 1.06, 3.14, 1.29}
+)
+
+func TestPairedTTest(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+	}{
+		{
+			name: "increasing differences",
+			x:    []float64{1, 2, 3, 4, 5},
+			y:    []float64{0, 0, 0, 0, 0},
+			want: 0.013236,
+		},
+		{
+			name: "differences of both signs",
+			x:    []float64{0.2, 0.5, 0.3, 0.9, 0.4, 0.6},
+			y:    []float64{0.1, 0.4, 0.35, 0.7, 0.4, 0.5},
+			want: 0.091267,
+		},
+		{
+			name: "symmetric in the order of the runs",
+			x:    []float64{0.1, 0.4, 0.35, 0.7, 0.4, 0.5},
+			y:    []float64{0.2, 0.5, 0.3, 0.9, 0.4, 0.6},
+			want: 0.091267,
+		},
+		{
+			name: "wilcox.test example",
+			x:    testSignificanceX,
+			y:    testSignificanceY,
+			want: 0.016177,
+		},
+		{
+			name: "identical runs",
+			x:    []float64{0.1, 0.2, 0.3},
+			y:    []float64{0.1, 0.2, 0.3},
+			want: 1,
+		},
+		{
+			name: "constant difference",
+			x:    []float64{0.2, 0.3, 0.4},
+			y:    []float64{0.1, 0.2, 0.3},
+			want: 0,
+		},
+		{
+			name: "single topic",
+			x:    []float64{0.5},
+			y:    []float64{0.1},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pairedTTest(tt.x, tt.y); math.Abs(got-tt.want) > 1e-5 {
+				t.Errorf("pairedTTest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWilcoxonSignedRank(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+	}{
+		{
+			name: "increasing differences",
+			x:    []float64{1, 2, 3, 4, 5},
+			y:    []float64{0, 0, 0, 0, 0},
+			want: 0.059058,
+		},
+		{
+			name: "wilcox.test example",
+			x:    testSignificanceX,
+			y:    testSignificanceY,
+			want: 0.044011,
+		},
+		{
+			name: "symmetric in the order of the runs",
+			x:    testSignificanceY,
+			y:    testSignificanceX,
+			want: 0.044011,
+		},
+		{
+			// The differences are 1, 1, -1, 2, 2, 3 and 0, so the zero is discarded and the ties share their ranks.
+			name: "ties and zeros",
+			x:    []float64{2, 2, 0, 3, 3, 4, 5},
+			y:    []float64{1, 1, 1, 1, 1, 1, 5},
+			want: 0.088984,
+		},
+		{
+			name: "identical runs",
+			x:    []float64{0.1, 0.2, 0.3},
+			y:    []float64{0.1, 0.2, 0.3},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wilcoxonSignedRank(tt.x, tt.y); math.Abs(got-tt.want) > 1e-5 {
+				t.Errorf("wilcoxonSignedRank() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareEvaluations(t *testing.T) {
+	evaluations := map[string]map[string]float64{
+		"1":           {"precision": 0.5, "recall": 0.9},
+		"2":           {"precision": 0.2, "recall": 0.8},
+		"3":           {"precision": 0.3},
+		"4":           {"precision": 0.7, "recall": 0.1},
+		AggregateMean: {"precision": 0.425, "recall": 0.6},
+	}
+	baseline := map[string]map[string]float64{
+		"1":           {"precision": 0.4, "recall": 0.9},
+		"2":           {"precision": 0.2, "recall": 0.7},
+		"3":           {"precision": 0.6, "recall": 0.5},
+		AggregateMean: {"precision": 0.4, "recall": 0.7},
+	}
+
+	tests := []struct {
+		measure string
+		want    Significance
+	}{
+		{
+			measure: "precision",
+			want:    Significance{Topics: 3, Mean: 1.0 / 3, BaselineMean: 0.4, Wins: 1, Ties: 1, Losses: 1},
+		},
+		{
+			measure: "recall",
+			want:    Significance{Topics: 2, Mean: 0.85, BaselineMean: 0.8, Wins: 1, Ties: 1},
+		},
+	}
+
+	comparison := CompareEvaluations(evaluations, baseline)
+	if len(comparison) != len(tests) {
+		t.Fatalf("CompareEvaluations() compared %d measures, want %d", len(comparison), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.measure, func(t *testing.T) {
+			got := comparison[tt.measure]
+			if got.Topics != tt.want.Topics || got.Wins != tt.want.Wins || got.Ties != tt.want.Ties || got.Losses != tt.want.Losses {
+				t.Errorf("CompareEvaluations() = %+v, want %+v", got, tt.want)
+			}
+			if math.Abs(got.Mean-tt.want.Mean) > 1e-9 || math.Abs(got.BaselineMean-tt.want.BaselineMean) > 1e-9 {
+				t.Errorf("CompareEvaluations() means = %v and %v, want %v and %v", got.Mean, got.BaselineMean, tt.want.Mean, tt.want.BaselineMean)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package boogie
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SweepConfiguration is a single configuration of a parameter sweep.
+type SweepConfiguration struct {
+	// Name identifies the configuration by the value of each axis (e.g. size=100,lambda=0.5).
+	Name string
+	// Values are the value of each axis of the sweep.
+	Values   []interface{}
+	Pipeline Pipeline
+	// Directories are where the outputs of the configuration are written.
+	Directories []string
+}
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._=,+-]+`)
+
+// axisLabel is the name of an axis in configuration names and the summary, which is the last element of the path
+// unless a name is specified.
+func axisLabel(axis SweepAxis) string {
+	if len(axis.Name) > 0 {
+		return axis.Name
+	}
+	p := strings.Split(axis.Path, ".")
+	return p[len(p)-1]
+}
+
+// sweepValue formats the value of an axis for configuration names and the summary.
+func sweepValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case []interface{}:
+		v := make([]string, len(x))
+		for i, item := range x {
+			v[i] = sweepValue(item)
+		}
+		return strings.Join(v, "+")
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// setPath sets the value at a dot-separated path (e.g. statistic.options.search.size) of a decoded JSON value.
+// Numbers in the path index arrays, and objects are created for any missing elements along the way.
+func setPath(root interface{}, p string, v interface{}) error {
+	keys := strings.Split(p, ".")
+	node := root
+	for i, key := range keys {
+		last := i == len(keys)-1
+		switch n := node.(type) {
+		case map[string]interface{}:
+			if last {
+				n[key] = v
+				return nil
+			}
+			if child, ok := n[key].(map[string]interface{}); ok {
+				node = child
+			} else if child, ok := n[key].([]interface{}); ok {
+				node = child
+			} else {
+				child := make(map[string]interface{})
+				n[key] = child
+				node = child
+			}
+		case []interface{}:
+			j, err := strconv.Atoi(key)
+			if err != nil || j < 0 || j >= len(n) {
+				return fmt.Errorf("%v is not a valid index of %v in the sweep path %v", key, strings.Join(keys[:i], "."), p)
+			}
+			if last {
+				n[j] = v
+				return nil
+			}
+			if n[j] == nil {
+				n[j] = make(map[string]interface{})
+			}
+			node = n[j]
+		default:
+			return fmt.Errorf("%v is not an object or array in the sweep path %v", strings.Join(keys[:i], "."), p)
+		}
+	}
+	return nil
+}
+
+// namespaceOutputs places every file a pipeline writes inside a directory, so that the configurations of a sweep do
+// not overwrite each other. Inputs (e.g. qrels) and caches are shared between configurations. The directories that
+// the files are written to are returned, so they can be created before running the configuration.
+func namespaceOutputs(dsl *Pipeline, dir string) []string {
+	dirs := []string{dir}
+	namespace := func(file string, isDir bool) string {
+		if len(file) == 0 {
+			return file
+		}
+		file = path.Join(dir, file)
+		if isDir {
+			dirs = append(dirs, file)
+		} else {
+			dirs = append(dirs, path.Dir(file))
+		}
+		return file
+	}
+	for i := range dsl.Output.Measurements {
+		dsl.Output.Measurements[i].Filename = namespace(dsl.Output.Measurements[i].Filename, false)
+	}
+	for i := range dsl.Output.Evaluations.Measurements {
+		dsl.Output.Evaluations.Measurements[i].Filename = namespace(dsl.Output.Evaluations.Measurements[i].Filename, false)
+	}
+	dsl.Output.Evaluations.Significance = namespace(dsl.Output.Evaluations.Significance, false)
+	dsl.Output.Trec.Output = namespace(dsl.Output.Trec.Output, false)
+	dsl.Output.Errors = namespace(dsl.Output.Errors, false)
+	dsl.Transformations.Output = namespace(dsl.Transformations.Output, true)
+	dsl.Checkpoint.Path = namespace(dsl.Checkpoint.Path, true)
+	for i, source := range dsl.Statistic.Sources {
+		if output, ok := source["output"].(string); ok {
+			dsl.Statistic.Sources[i]["output"] = namespace(output, false)
+		}
+	}
+	return dirs
+}
+
+// ExpandSweep creates a configuration of the pipeline for every combination of the values of the axes in the `sweep`
+// section of the DSL (i.e. the cartesian product). The outputs of each configuration are written to a directory named
+// after the configuration, inside the `output` directory of the sweep.
+func ExpandSweep(dsl Pipeline) ([]SweepConfiguration, error) {
+	axes := dsl.Sweep.Axes
+	for _, axis := range axes {
+		if len(axis.Path) == 0 {
+			return nil, fmt.Errorf("a path must be specified for each axis of a sweep")
+		}
+		if len(axis.Values) == 0 {
+			return nil, fmt.Errorf("at least one value must be specified for the sweep axis %v", axis.Path)
+		}
+	}
+
+	base := dsl
+	base.Sweep = PipelineSweep{}
+	b, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+
+	var configurations []SweepConfiguration
+	// Iterate through the combinations like an odometer, with the last axis changing fastest.
+	indices := make([]int, len(axes))
+	for {
+		var root interface{}
+		err = json.Unmarshal(b, &root)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]interface{}, len(axes))
+		names := make([]string, len(axes))
+		for i, axis := range axes {
+			values[i] = axis.Values[indices[i]]
+			names[i] = fmt.Sprintf("%s=%s", axisLabel(axis), sweepValue(values[i]))
+			err = setPath(root, axis.Path, values[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		name := unsafeFilename.ReplaceAllString(strings.Join(names, ","), "_")
+
+		// Configurations are validated, since unknown keys in the path would otherwise be silently ignored.
+		c, err := json.Marshal(root)
+		if err != nil {
+			return nil, err
+		}
+		err = ValidateJSON(name, c)
+		if err != nil {
+			return nil, err
+		}
+		var p Pipeline
+		err = json.Unmarshal(c, &p)
+		if err != nil {
+			return nil, err
+		}
+		dirs := namespaceOutputs(&p, path.Join(dsl.Sweep.Output, name))
+		configurations = append(configurations, SweepConfiguration{Name: name, Values: values, Pipeline: p, Directories: dirs})
+
+		i := len(indices) - 1
+		for ; i >= 0; i-- {
+			indices[i]++
+			if indices[i] < len(axes[i].Values) {
+				break
+			}
+			indices[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+	return configurations, nil
+}
+
+// RunSweep runs every configuration of the sweep in the DSL, and writes a summary of the mean of each evaluation
+// measure for each configuration to the `summary` file of the sweep.
+func RunSweep(dsl Pipeline) error {
+	configurations, err := ExpandSweep(dsl)
+	if err != nil {
+		return err
+	}
+
+	means := make([]map[string]float64, len(configurations))
+	for i, c := range configurations {
+		log.Printf("running sweep configuration %d of %d: %s\n", i+1, len(configurations), c.Name)
+		for _, dir := range c.Directories {
+			err := os.MkdirAll(dir, 0777)
+			if err != nil {
+				return err
+			}
+		}
+
+		r, err := NewRun(c.Pipeline)
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.Name, err)
+		}
+		evaluations, err := r.run()
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.Name, err)
+		}
+		means[i] = AggregateEvaluations(evaluations)[AggregateMean]
+
+		// The summary is rewritten after each configuration, so it is available while the sweep is running.
+		if len(dsl.Sweep.Summary) > 0 {
+			err = writeSweepSummary(dsl.Sweep.Summary, dsl.Sweep.Axes, configurations[:i+1], means[:i+1])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeSweepSummary writes a comma separated table with a row for each configuration, containing the value of each
+// axis and the mean of each evaluation measure.
+func writeSweepSummary(filename string, axes []SweepAxis, configurations []SweepConfiguration, means []map[string]float64) error {
+	seen := make(map[string]bool)
+	var measures []string
+	for _, m := range means {
+		for measure := range m {
+			if !seen[measure] {
+				seen[measure] = true
+				measures = append(measures, measure)
+			}
+		}
+	}
+	sort.Strings(measures)
+
+	buff := new(bytes.Buffer)
+	w := csv.NewWriter(buff)
+	header := []string{"configuration"}
+	for _, axis := range axes {
+		header = append(header, axisLabel(axis))
+	}
+	err := w.Write(append(header, measures...))
+	if err != nil {
+		return err
+	}
+	for i, c := range configurations {
+		row := []string{c.Name}
+		for _, v := range c.Values {
+			row = append(row, sweepValue(v))
+		}
+		for _, measure := range measures {
+			if v, ok := means[i][measure]; ok {
+				row = append(row, strconv.FormatFloat(v, 'f', -1, 64))
+			} else {
+				row = append(row, "")
+			}
+		}
+		err = w.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if w.Error() != nil {
+		return w.Error()
+	}
+	return ioutil.WriteFile(filename, buff.Bytes(), 0644)
+}
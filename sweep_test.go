@@ -0,0 +1,63 @@
+package boogie
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestRunSweepSources(t *testing.T) {
+	dsl, dir, cleanup := newTestPipeline(t, map[string]string{"1": "heart"})
+	defer cleanup()
+
+	// Each configuration measures the same query on a different collection.
+	var values []interface{}
+	for name, c := range map[string]string{"a": testFusionCollectionA, "b": testFusionCollectionB} {
+		collection := filepath.Join(dir, name+".txt")
+		err := ioutil.WriteFile(collection, []byte(c), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, map[string]interface{}{
+			"collection": collection,
+			"format":     CollectionMEDLINE,
+			"index":      filepath.Join(dir, name+".index"),
+		})
+	}
+	dsl.Measurements = []string{"retrieval_size"}
+	dsl.Output.Measurements = []MeasurementOutput{{Format: "json", Filename: "measurements.json"}}
+	dsl.Sweep = PipelineSweep{
+		Output:  filepath.Join(dir, "sweep"),
+		Summary: filepath.Join(dir, "sweep.csv"),
+		Axes:    []SweepAxis{{Path: "statistic.options", Values: values}},
+	}
+
+	err := RunSweep(dsl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "sweep", "*", "measurements.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []float64
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]map[string]float64
+		err = json.Unmarshal(b, &m)
+		if err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		sizes = append(sizes, m["1"]["RetrievalSize"])
+	}
+	// The measurement of one configuration is not cached for the other.
+	sort.Float64s(sizes)
+	if len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 3 {
+		t.Errorf("retrieval sizes = %v, want [2 3]", sizes)
+	}
+}
@@ -2,91 +2,631 @@ package boogie
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// TemplateContext contains the arguments available to a template.
+type TemplateContext struct {
+	// Args are the positional arguments, referred to as $0, $1, etc.
+	Args []string
+	// Values are named arguments (e.g. --set index=pubmed), which take precedence over the definitions in templates.
+	Values map[string]string
+	// Format is the format of the pipeline (json, yaml, or toml). If empty, it is determined from the filename of the
+	// pipeline, or is JSON.
+	Format string
+	// inherited are the values of the template that included this one.
+	inherited map[string]templateValue
+}
+
+// NewTemplateContext creates the context of a template from positional arguments and name=value pairs.
+func NewTemplateContext(args []string, set []string) (TemplateContext, error) {
+	ctx := TemplateContext{Args: args, Values: make(map[string]string)}
+	for _, s := range set {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return ctx, fmt.Errorf("named template argument '%s' must be in the form name=value", s)
+		}
+		ctx.Values[kv[0]] = kv[1]
+	}
+	return ctx, nil
+}
+
+// TemplateSpan is a part of an expanded template that was substituted from a template.
+type TemplateSpan struct {
+	// Start and End are byte offsets into the expanded template.
+	Start, End int
+	Name       string
+	// Origin describes where the value of the template was defined (e.g. argument $0).
+	Origin string
+}
+
+func (s TemplateSpan) String() string {
+	return fmt.Sprintf("%s (%s)", s.Name, s.Origin)
+}
+
+// templateValue is the value of a template, and where it was defined.
+type templateValue struct {
+	text   string
+	origin string
+	// fragment values (i.e. the contents of files) are inserted as-is, rather than as JSON values.
+	fragment bool
+	// spans are the templates substituted within a fragment.
+	spans []TemplateSpan
+}
+
+// templateDefinition is a `template` or `default` line in the header of a template.
+type templateDefinition struct {
+	name, value string
+	line        int
+}
+
+// templateLine is a line of the body of a template.
+type templateLine struct {
+	text string
+	line int
+}
+
+// renderedLine is a line of an expanded template, and the templates substituted into it.
+type renderedLine struct {
+	templateLine
+	spans []TemplateSpan
+	// origins are the byte offsets in the line of the template that each byte of text came from, followed by the
+	// offset of the end of the line.
+	origins []int
+}
+
+// templateSources are the lines of an expanded template, which relate its positions to those of the template.
+type templateSources []renderedLine
+
+// position finds the line and column of the template that a line and column of the expanded template came from. The
+// position of anything substituted from a template (including each line of the contents of a file) is that of its
+// reference (e.g. %name).
+func (s templateSources) position(line, col int) (int, int) {
+	n := 1
+	for _, l := range s {
+		physical := strings.Split(l.text, "\n")
+		if line >= n+len(physical) {
+			n += len(physical)
+			continue
+		}
+		offset := col - 1
+		for _, p := range physical[:line-n] {
+			offset += len(p) + 1
+		}
+		if offset >= len(l.origins) {
+			offset = len(l.origins) - 1
+		}
+		return l.line, l.origins[offset] + 1
+	}
+	if len(s) > 0 {
+		return s[len(s)-1].line + 1, 1
+	}
+	return line, col
+}
+
+// templateNode is either a line of the body of a template, or an #if or #each block.
+type templateNode struct {
+	templateLine
+	directive string
+	arg       string
+	body, els []templateNode
+}
+
+var environmentValue = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
 func templateString(r io.Reader, args ...string) (string, error) {
+	return templateStringWith(r, TemplateContext{Args: args})
+}
+
+// templateStringWith expands a template. The header of a template defines values using the following lines:
+//
+//	template name $N         the Nth positional argument
+//	template name ${NAME}    the environment variable NAME
+//	template name file       the (templated) contents of a file
+//	default name value       a value used when name is not otherwise defined
+//
+// The body of the template starts at the first line beginning with {, ", %, #if, or #each (or, in YAML and TOML, the
+// first line that is not a `template` or `default` line or a comment). Within the body, %name and @name are replaced
+// with their values (%% and @@ are a literal % and @), and the following directives include sections conditionally or
+// repeatedly:
+//
+//	#if name (or !name, name=value, name!=value)
+//	#else
+//	#end
+//	#each item in name       repeat the section for each comma separated value of name, joined by commas
+//	#end
+//
+// Within a JSON string, values are escaped. Elsewhere, values are inserted as JSON (e.g. numbers or arrays) if they
+// are valid JSON and as strings otherwise, while the contents of files are inserted as-is. In YAML and TOML, lines
+// beginning with # that are not directives are comments.
+func templateStringWith(r io.Reader, ctx TemplateContext) (string, error) {
+	s, _, _, err := expandTemplate(r, ctx)
+	return s, err
+}
+
+// expandTemplate expands a template, returning the parts of the result that were substituted from templates, and the
+// lines of the template that the result came from.
+func expandTemplate(r io.Reader, ctx TemplateContext) (string, []TemplateSpan, templateSources, error) {
 	s := bufio.NewScanner(r)
-	templates := make(map[string]string)
+	var (
+		definitions []templateDefinition
+		defaults    = make(map[string]templateValue)
+		body        []templateLine
+	)
 	parsing := false
 	pc := 0
-	var buff string
 	for s.Scan() {
 		pc++
 		line := s.Text()
-		if len(line) > 0 {
+		if len(strings.TrimSpace(line)) > 0 {
 			x := strings.TrimSpace(line)[0]
-			if x == '{' || x == '"' || x == '%' {
+			if d, _ := directive(line); x == '{' || x == '"' || x == '%' || d == "if" || d == "each" {
+				parsing = true
+			} else if c := strings.SplitN(line, " ", 2)[0]; !isJSON(ctx.Format) && x != '#' && c != "template" && c != "default" {
 				parsing = true
 			}
 		}
-		if !parsing {
-			command := strings.Split(line, " ")
-			if len(command) == 3 {
-				if command[0] == "template" {
-					if len(command[2]) > 0 && command[2][0] == '$' {
-						index, err := strconv.Atoi(command[2][1:])
-						if err != nil {
-							return buff, err
-						}
-						if index >= len(args) {
-							return buff, fmt.Errorf("index of template argument is higher than the number of arguments, see line %d", pc)
-						}
-						templates[command[1]] = args[index]
-					} else {
-						f, err := os.OpenFile(command[2], os.O_RDONLY, 0644)
-						if err != nil {
-							return buff, err
-						}
-						templates[command[1]], err = templateString(f, args...)
-						if err != nil {
-							return buff, err
-						}
-						//b, err := ioutil.ReadFile(command[2])
-						//if err != nil {
-						//	return buff, err
-						//}
-						//templates[command[1]] = string(b)
-						//if err != nil {
-						//	return buff, err
-						//}
-					}
-				} else {
-					fmt.Println("------------")
-					fmt.Println(">>>", line)
-					fmt.Println("------------")
-					fmt.Println(buff)
-					return buff, fmt.Errorf("unrecognised templating command '%s' on line %d", command[0], pc)
+		if parsing {
+			body = append(body, templateLine{text: line, line: pc})
+			continue
+		}
+		command := strings.SplitN(line, " ", 3)
+		if len(command) != 3 || (!isJSON(ctx.Format) && strings.HasPrefix(strings.TrimSpace(line), "#")) {
+			continue
+		}
+		switch command[0] {
+		case "template":
+			definitions = append(definitions, templateDefinition{name: command[1], value: command[2], line: pc})
+		case "default":
+			if _, ok := defaults[command[1]]; !ok {
+				v, err := environmentOrLiteral(command[2], pc)
+				if err != nil {
+					return "", nil, nil, err
 				}
+				defaults[command[1]] = v
 			}
+		default:
+			return "", nil, nil, fmt.Errorf("unrecognised templating command '%s' on line %d", command[0], pc)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", nil, nil, err
+	}
+
+	// Named arguments (and the values of an including template) take precedence over template definitions, which take
+	// precedence over defaults.
+	named := make(map[string]templateValue)
+	for k, v := range ctx.inherited {
+		named[k] = v
+	}
+	for k, v := range ctx.Values {
+		named[k] = templateValue{text: v, origin: "--set " + k}
+	}
+	templates := make(map[string]templateValue)
+	for k, v := range defaults {
+		templates[k] = v
+	}
+	for k, v := range named {
+		templates[k] = v
+	}
+
+	// Arguments and environment variables are resolved before files, so that files can refer to them.
+	var files []templateDefinition
+	for _, d := range definitions {
+		if _, ok := named[d.name]; ok {
+			continue
+		}
+		if len(d.value) > 0 && d.value[0] == '$' {
+			v, err := resolveTemplate(d, ctx)
+			if err != nil {
+				if _, ok := defaults[d.name]; ok {
+					continue
+				}
+				return "", nil, nil, err
+			}
+			templates[d.name] = v
 		} else {
+			files = append(files, d)
+		}
+	}
+	for _, d := range files {
+		inherited := make(map[string]templateValue)
+		for k, v := range templates {
+			inherited[k] = v
+		}
+		v, err := resolveTemplate(d, TemplateContext{Args: ctx.Args, Values: ctx.Values, Format: PipelineFormat(d.value), inherited: inherited})
+		if err != nil {
+			if _, ok := defaults[d.name]; ok {
+				continue
+			}
+			return "", nil, nil, err
+		}
+		templates[d.name] = v
+	}
+
+	nodes, _, end, err := parseTemplateBlock(body, 0, isJSON(ctx.Format))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if end != nil {
+		return "", nil, nil, fmt.Errorf("unexpected #%s on line %d", end.directive, end.line)
+	}
+	lines, err := renderTemplate(nodes, templates)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	buff := new(bytes.Buffer)
+	var spans []TemplateSpan
+	for _, line := range lines {
+		for _, span := range line.spans {
+			span.Start += buff.Len()
+			span.End += buff.Len()
+			spans = append(spans, span)
+		}
+		buff.WriteString(fmt.Sprintln(line.text))
+	}
+	return buff.String(), spans, lines, nil
+}
+
+// environmentOrLiteral resolves ${NAME} to the value of an environment variable; any other value is used as-is.
+func environmentOrLiteral(value string, line int) (templateValue, error) {
+	if m := environmentValue.FindStringSubmatch(value); m != nil {
+		v, ok := os.LookupEnv(m[1])
+		if !ok {
+			return templateValue{}, fmt.Errorf("environment variable %s is not set, see line %d", m[1], line)
+		}
+		return templateValue{text: v, origin: "environment variable " + m[1]}, nil
+	}
+	return templateValue{text: value, origin: fmt.Sprintf("default on line %d", line)}, nil
+}
+
+// resolveTemplate finds the value of a `template` line.
+func resolveTemplate(d templateDefinition, ctx TemplateContext) (templateValue, error) {
+	switch {
+	case environmentValue.MatchString(d.value):
+		return environmentOrLiteral(d.value, d.line)
+	case len(d.value) > 0 && d.value[0] == '$':
+		index, err := strconv.Atoi(d.value[1:])
+		if err != nil {
+			return templateValue{}, err
+		}
+		if index >= len(ctx.Args) {
+			return templateValue{}, fmt.Errorf("index of template argument is higher than the number of arguments, see line %d", d.line)
+		}
+		return templateValue{text: ctx.Args[index], origin: "argument " + d.value}, nil
+	}
+	f, err := os.OpenFile(d.value, os.O_RDONLY, 0644)
+	if err != nil {
+		return templateValue{}, err
+	}
+	defer f.Close()
+	s, spans, _, err := expandTemplate(f, ctx)
+	if err != nil {
+		return templateValue{}, fmt.Errorf("%s: %v", d.value, err)
+	}
+	return templateValue{text: s, origin: "file " + d.value, fragment: true, spans: spans}, nil
+}
+
+// templateDirectives are the directives that can appear in the body of a template.
+var templateDirectives = map[string]bool{"if": true, "else": true, "end": true, "each": true}
+
+// directive returns the directive of a line (e.g. if) and its argument, or an empty directive.
+func directive(line string) (string, string) {
+	x := strings.TrimSpace(line)
+	if len(x) == 0 || x[0] != '#' {
+		return "", ""
+	}
+	d := strings.SplitN(x[1:], " ", 2)
+	if len(d) == 1 {
+		return d[0], ""
+	}
+	return d[0], strings.TrimSpace(d[1])
+}
+
+// parseTemplateBlock parses lines into nodes until an #else or #end, which is returned as the end of the block. Unless
+// strict, lines beginning with # that are not directives are comments.
+func parseTemplateBlock(lines []templateLine, i int, strict bool) ([]templateNode, int, *templateNode, error) {
+	var nodes []templateNode
+	for i < len(lines) {
+		l := lines[i]
+		d, arg := directive(l.text)
+		i++
+		if !strict && !templateDirectives[d] {
+			d = ""
+		}
+		switch d {
+		case "":
+			nodes = append(nodes, templateNode{templateLine: l})
+		case "else", "end":
+			return nodes, i, &templateNode{templateLine: l, directive: d}, nil
+		case "if", "each":
+			if len(arg) == 0 {
+				return nil, i, nil, fmt.Errorf("#%s requires an argument on line %d", d, l.line)
+			}
+			n := templateNode{templateLine: l, directive: d, arg: arg}
+			var (
+				end *templateNode
+				err error
+			)
+			n.body, i, end, err = parseTemplateBlock(lines, i, strict)
+			if err != nil {
+				return nil, i, nil, err
+			}
+			if end != nil && end.directive == "else" && d == "if" {
+				n.els, i, end, err = parseTemplateBlock(lines, i, strict)
+				if err != nil {
+					return nil, i, nil, err
+				}
+			}
+			if end == nil || end.directive != "end" {
+				return nil, i, nil, fmt.Errorf("#%s on line %d is missing #end", d, l.line)
+			}
+			nodes = append(nodes, n)
+		default:
+			return nil, i, nil, fmt.Errorf("unrecognised templating directive '#%s' on line %d", d, l.line)
+		}
+	}
+	return nodes, i, nil, nil
+}
+
+// templateCondition evaluates the condition of an #if directive.
+func templateCondition(cond string, templates map[string]templateValue) bool {
+	if i := strings.Index(cond, "!="); i > 0 {
+		return templates[strings.TrimSpace(cond[:i])].text != strings.TrimSpace(cond[i+2:])
+	}
+	if i := strings.Index(cond, "="); i > 0 {
+		return templates[strings.TrimSpace(cond[:i])].text == strings.TrimSpace(cond[i+1:])
+	}
+	if strings.HasPrefix(cond, "!") {
+		return !templateCondition(cond[1:], templates)
+	}
+	v, ok := templates[cond]
+	return ok && len(v.text) > 0 && v.text != "false" && v.text != "0"
+}
+
+// renderTemplate expands the directives of nodes and substitutes the values of templates into each line.
+func renderTemplate(nodes []templateNode, templates map[string]templateValue) ([]renderedLine, error) {
+	var lines []renderedLine
+	for _, n := range nodes {
+		switch n.directive {
+		case "if":
+			block := n.els
+			if templateCondition(n.arg, templates) {
+				block = n.body
+			}
+			l, err := renderTemplate(block, templates)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, l...)
+		case "each":
+			e := strings.Split(n.arg, " ")
+			if len(e) != 3 || e[1] != "in" {
+				return nil, fmt.Errorf("#each must be in the form '#each item in name' on line %d", n.line)
+			}
+			list, ok := templates[e[2]]
+			if !ok {
+				return nil, fmt.Errorf("undefined template reference %s on line %d", e[2], n.line)
+			}
+			scope := make(map[string]templateValue)
 			for k, v := range templates {
-				template := fmt.Sprintf("%%%s", k)
-				if strings.Contains(line, template) {
-					line = strings.Replace(line, template, v, -1)
+				scope[k] = v
+			}
+			var items []string
+			if len(strings.TrimSpace(list.text)) > 0 {
+				items = strings.Split(list.text, ",")
+			}
+			for i, item := range items {
+				scope[e[0]] = templateValue{text: strings.TrimSpace(item), origin: fmt.Sprintf("#each on line %d", n.line)}
+				l, err := renderTemplate(n.body, scope)
+				if err != nil {
+					return nil, err
+				}
+				// Each repetition is separated by a comma, so that they form the items of a JSON array or object.
+				if i > 0 && len(lines) > 0 {
+					last := &lines[len(lines)-1]
+					last.text += ","
+					last.origins = append(last.origins, last.origins[len(last.origins)-1])
+				}
+				lines = append(lines, l...)
+			}
+		default:
+			l, err := substituteTemplates(n.templateLine, templates)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+func isIdentifier(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// substituteTemplates replaces %name and @name in a line with their values, in a single pass from left to right. A
+// reference is the whole identifier following % or @, so %path2 refers to path2 and never to path. References to
+// undefined names with % are an error; @ is left as-is, since it often appears in strings (e.g. email addresses). %%
+// and @@ are a literal % and @.
+func substituteTemplates(l templateLine, templates map[string]templateValue) (renderedLine, error) {
+	text := l.text
+	buff := new(bytes.Buffer)
+	var (
+		spans   []TemplateSpan
+		origins []int
+	)
+	// mark records that the bytes written since the last mark came from offset at of the line.
+	mark := func(at int) {
+		for len(origins) < buff.Len() {
+			origins = append(origins, at)
+		}
+	}
+	inString := false
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case inString && c == '\\' && i+1 < len(text):
+			buff.WriteString(text[i : i+2])
+			mark(i)
+			i += 2
+			continue
+		case c == '"':
+			inString = !inString
+		case (c == '%' || c == '@') && i+1 < len(text) && text[i+1] == c:
+			buff.WriteByte(c)
+			mark(i)
+			i += 2
+			continue
+		case (c == '%' || c == '@') && i+1 < len(text) && isIdentifier(text[i+1], true):
+			j := i + 1
+			for j < len(text) && isIdentifier(text[j], false) {
+				j++
+			}
+			name := text[i+1 : j]
+			v, ok := templates[name]
+			if !ok {
+				if c == '%' {
+					return renderedLine{}, fmt.Errorf("undefined template reference %s on line %d", text[i:j], l.line)
+				}
+				break
+			}
+			start := buff.Len()
+			switch {
+			case inString:
+				// Values are escaped as the contents of a JSON string.
+				b, err := json.Marshal(v.text)
+				if err != nil {
+					return renderedLine{}, err
+				}
+				buff.Write(b[1 : len(b)-1])
+			case v.fragment:
+				buff.WriteString(v.text)
+				for _, span := range v.spans {
+					span.Start += start
+					span.End += start
+					spans = append(spans, span)
+				}
+			case json.Valid([]byte(v.text)):
+				buff.WriteString(v.text)
+			default:
+				b, err := json.Marshal(v.text)
+				if err != nil {
+					return renderedLine{}, err
+				}
+				buff.Write(b)
+			}
+			spans = append(spans, TemplateSpan{Start: start, End: buff.Len(), Name: name, Origin: v.origin})
+			mark(i)
+			i = j
+			continue
+		}
+		buff.WriteByte(c)
+		mark(i)
+		i++
+	}
+	origins = append(origins, len(text))
+	return renderedLine{templateLine: templateLine{text: buff.String(), line: l.line}, spans: spans, origins: origins}, nil
+}
+
+// TemplateProvenance is the templates that produced a key of an expanded pipeline, from outermost to innermost.
+type TemplateProvenance struct {
+	Path      string
+	Templates []TemplateSpan
+}
+
+// Provenance expands a template and reports which templates produced each key (or its value) and array item of the
+// pipeline. Keys that were not produced by a template are omitted.
+func Provenance(r io.Reader, ctx TemplateContext) ([]TemplateProvenance, error) {
+	if !isJSON(ctx.Format) {
+		return nil, fmt.Errorf("provenance can only be reported for json pipelines")
+	}
+	s, spans, _, err := expandTemplate(r, ctx)
+	if err != nil {
+		return nil, err
+	}
+	p := &jsonParser{data: []byte(s), line: 1, col: 1}
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%d:%d: %v", p.line, p.col, err)
+	}
+	// Outer spans start earlier, or at the same place and end later.
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+	// The templates of a key are those that produced the key, or its value if it is not an object or array (whose
+	// keys are reported separately).
+	overlaps := func(n *jsonNode, span TemplateSpan) bool {
+		return span.Start < n.end && span.End > n.offset
+	}
+	scalar := func(n *jsonNode) bool {
+		return n.kind != "object" && n.kind != "array"
+	}
+	templates := func(key, value *jsonNode) []TemplateSpan {
+		var t []TemplateSpan
+		for _, span := range spans {
+			if (key != nil && overlaps(key, span)) || (scalar(value) && overlaps(value, span)) {
+				t = append(t, span)
+			}
+		}
+		return t
+	}
+
+	var provenance []TemplateProvenance
+	var walk func(n *jsonNode, path string)
+	walk = func(n *jsonNode, path string) {
+		switch n.kind {
+		case "object":
+			for _, key := range n.keys {
+				p := path + "." + key
+				if t := templates(n.keyNodes[key], n.fields[key]); len(t) > 0 {
+					provenance = append(provenance, TemplateProvenance{Path: p, Templates: t})
 				}
-				template2 := fmt.Sprintf("@%s", k)
-				if strings.Contains(line, template2) {
-					line = strings.Replace(line, template2, v, -1)
+				walk(n.fields[key], p)
+			}
+		case "array":
+			for i, item := range n.items {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				if t := templates(nil, item); len(t) > 0 {
+					provenance = append(provenance, TemplateProvenance{Path: p, Templates: t})
 				}
+				walk(item, p)
 			}
-			buff += fmt.Sprintln(line)
 		}
 	}
-	return buff, nil
+	walk(root, "$")
+	return provenance, nil
 }
 
 func Template(r io.Reader, args ...string) (Pipeline, error) {
+	return TemplateWith(r, TemplateContext{Args: args})
+}
+
+// TemplateWith expands a template using the positional and named arguments of ctx, and parses the result.
+// Paths in `extends` and `include` are relative to the working directory.
+func TemplateWith(r io.Reader, ctx TemplateContext) (Pipeline, error) {
+	return TemplateFile("", r, ctx)
+}
+
+// TemplateFile expands the template of a pipeline file using the positional and named arguments of ctx, resolves any
+// `extends` and `include` keys relative to the file, and parses the result.
+func TemplateFile(filename string, r io.Reader, ctx TemplateContext) (Pipeline, error) {
 	var p Pipeline
-	t, err := templateString(r, args...)
+	b, _, err := resolvePipeline(filename, r, ctx)
 	if err != nil {
 		return Pipeline{}, err
 	}
-	err = json.Unmarshal([]byte(t), &p)
+	err = json.Unmarshal(b, &p)
 	return p, err
 }
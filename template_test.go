@@ -0,0 +1,128 @@
+package boogie
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplateStringWith(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		args     []string
+		set      []string
+		want     string
+		err      bool
+	}{
+		{
+			name:     "argument",
+			template: "template path $0\n{\"path\": \"%path\"}\n",
+			args:     []string{"topics.txt"},
+			want:     "{\"path\": \"topics.txt\"}\n",
+		},
+		{
+			name:     "default",
+			template: "default size 100\n{\"size\": %size}\n",
+			want:     "{\"size\": 100}\n",
+		},
+		{
+			name:     "default for a missing argument",
+			template: "template size $0\ndefault size 100\n{\"size\": %size}\n",
+			want:     "{\"size\": 100}\n",
+		},
+		{
+			name:     "named argument over template and default",
+			template: "template size $0\ndefault size 100\n{\"size\": %size}\n",
+			args:     []string{"10"},
+			set:      []string{"size=1000"},
+			want:     "{\"size\": 1000}\n",
+		},
+		{
+			name:     "string value outside a string",
+			template: "default index pubmed\n{\"index\": %index}\n",
+			want:     "{\"index\": \"pubmed\"}\n",
+		},
+		{
+			name:     "escaped inside a string",
+			template: "template path $0\n{\"path\": \"%path\"}\n",
+			args:     []string{`a "b" \c`},
+			want:     "{\"path\": \"a \\\"b\\\" \\\\c\"}\n",
+		},
+		{
+			name:     "whole identifier",
+			template: "default path a\ndefault path2 b\n{\"path\": \"%path2/%path\"}\n",
+			want:     "{\"path\": \"b/a\"}\n",
+		},
+		{
+			name:     "prefix of an undefined identifier",
+			template: "default path a\n{\"path\": \"%path2\"}\n",
+			err:      true,
+		},
+		{
+			name:     "undefined",
+			template: "{\"path\": \"%pth\"}\n",
+			err:      true,
+		},
+		{
+			name:     "undefined at",
+			template: "{\"email\": \"me@example.com\"}\n",
+			want:     "{\"email\": \"me@example.com\"}\n",
+		},
+		{
+			name:     "literal percent",
+			template: "default path a\n{\"path\": \"%%path 100%\"}\n",
+			want:     "{\"path\": \"%path 100%\"}\n",
+		},
+		{
+			name:     "if",
+			template: "default pubmed true\n{\n#if pubmed\n\"source\": \"entrez\"\n#else\n\"source\": \"elasticsearch\"\n#end\n}\n",
+			want:     "{\n\"source\": \"entrez\"\n}\n",
+		},
+		{
+			name:     "else",
+			template: "{\n#if pubmed\n\"source\": \"entrez\"\n#else\n\"source\": \"elasticsearch\"\n#end\n}\n",
+			want:     "{\n\"source\": \"elasticsearch\"\n}\n",
+		},
+		{
+			name:     "if equals",
+			template: "default source entrez\n{\n#if source!=entrez\n\"index\": \"pubmed\"\n#end\n}\n",
+			want:     "{\n}\n",
+		},
+		{
+			name:     "each",
+			template: "default measures recall, precision\n{\"evaluation\": [\n#each m in measures\n\"%m\"\n#end\n]}\n",
+			want:     "{\"evaluation\": [\n\"recall\",\n\"precision\"\n]}\n",
+		},
+		{
+			name:     "each of an undefined name",
+			template: "{\"evaluation\": [\n#each m in measures\n\"%m\"\n#end\n]}\n",
+			err:      true,
+		},
+		{
+			name:     "missing end",
+			template: "{\n#if pubmed\n}\n",
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, err := NewTemplateContext(test.args, test.set)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := templateStringWith(strings.NewReader(test.template), ctx)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
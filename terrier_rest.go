@@ -0,0 +1,253 @@
+package boogie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"github.com/hscells/trecresults"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TerrierRESTStatisticsSource communicates with a Terrier index through a REST bridge, so that Terrier can be used
+// on platforms other than Windows. The bridge is not part of Terrier; it must respond to the following requests, each
+// with a 200 status (any other status is an error, reported with the body of the response):
+//
+//	GET /search?query=&size=&run_name=   a trec run ("topic Q0 document rank score run_name" lines) for the query.
+//	GET /term?term=&field=               {"df": 0, "ttf": 0} for the term in the field.
+//	GET /collection?field=               {"documents": 0, "terms": 0} for the field of the collection.
+//
+// The query is in the Terrier query language, and the topic of each result of a run is ignored. If the `properties`
+// option is configured, it is sent as the `properties` parameter of every request so that the bridge can load that
+// index. Methods not supported by the bridge (e.g. term vectors) return an error.
+type TerrierRESTStatisticsSource struct {
+	url        string
+	properties string
+	field      string
+	params     map[string]float64
+	options    stats.SearchOptions
+	client     *http.Client
+}
+
+type terrierTermStatistics struct {
+	DocumentFrequency  float64 `json:"df"`
+	TotalTermFrequency float64 `json:"ttf"`
+}
+
+type terrierCollectionStatistics struct {
+	Documents float64 `json:"documents"`
+	Terms     float64 `json:"terms"`
+}
+
+func (t TerrierRESTStatisticsSource) get(endpoint string, values url.Values) ([]byte, error) {
+	if len(t.properties) > 0 {
+		values.Set("properties", t.properties)
+	}
+	resp, err := t.client.Get(fmt.Sprintf("%s/%s?%s", strings.TrimSuffix(t.url, "/"), endpoint, values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("terrier bridge responded to %s with %s: %s", endpoint, resp.Status, string(b))
+	}
+	return b, nil
+}
+
+func (t TerrierRESTStatisticsSource) term(term, field string) (terrierTermStatistics, error) {
+	var s terrierTermStatistics
+	b, err := t.get("term", url.Values{"term": {term}, "field": {field}})
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
+func (t TerrierRESTStatisticsSource) collection(field string) (terrierCollectionStatistics, error) {
+	var s terrierCollectionStatistics
+	b, err := t.get("collection", url.Values{"field": {field}})
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
+func (t TerrierRESTStatisticsSource) SearchOptions() stats.SearchOptions {
+	return t.options
+}
+
+func (t TerrierRESTStatisticsSource) Parameters() map[string]float64 {
+	return t.params
+}
+
+func (t TerrierRESTStatisticsSource) TermFrequency(term, field, document string) (float64, error) {
+	return 0, fmt.Errorf("term frequency of a document is not supported by the terrier source")
+}
+
+func (t TerrierRESTStatisticsSource) TermVector(document string) (stats.TermVector, error) {
+	return nil, fmt.Errorf("term vectors are not supported by the terrier source")
+}
+
+func (t TerrierRESTStatisticsSource) DocumentFrequency(term, field string) (float64, error) {
+	s, err := t.term(term, field)
+	return s.DocumentFrequency, err
+}
+
+func (t TerrierRESTStatisticsSource) TotalTermFrequency(term, field string) (float64, error) {
+	s, err := t.term(term, field)
+	return s.TotalTermFrequency, err
+}
+
+func (t TerrierRESTStatisticsSource) InverseDocumentFrequency(term, field string) (float64, error) {
+	s, err := t.term(term, field)
+	if err != nil {
+		return 0, err
+	}
+	N, err := t.CollectionSize()
+	if err != nil {
+		return 0, err
+	}
+	if s.DocumentFrequency == 0 {
+		return 0, nil
+	}
+	return math.Log(N / s.DocumentFrequency), nil
+}
+
+func (t TerrierRESTStatisticsSource) VocabularySize(field string) (float64, error) {
+	s, err := t.collection(field)
+	return s.Terms, err
+}
+
+func (t TerrierRESTStatisticsSource) CollectionSize() (float64, error) {
+	s, err := t.collection(t.field)
+	return s.Documents, err
+}
+
+func (t TerrierRESTStatisticsSource) RetrievalSize(query cqr.CommonQueryRepresentation) (float64, error) {
+	results, err := t.Execute(pipeline.Query{Query: query}, stats.SearchOptions{Size: math.MaxInt32, RunName: t.options.RunName})
+	return float64(len(results)), err
+}
+
+func (t TerrierRESTStatisticsSource) Execute(query pipeline.Query, options stats.SearchOptions) (trecresults.ResultList, error) {
+	q, err := terrierQuery(query.Query)
+	if err != nil {
+		return nil, err
+	}
+	b, err := t.get("search", url.Values{
+		"query":    {q},
+		"size":     {strconv.Itoa(options.Size)},
+		"run_name": {options.RunName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	f, err := trecresults.ResultsFromReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	var results trecresults.ResultList
+	for _, l := range f.Results {
+		results = append(results, l...)
+	}
+	// The bridge does not know about topics, so set them here.
+	for _, r := range results {
+		r.Topic = query.Topic
+	}
+	return results, nil
+}
+
+// terrierQuery compiles a query into the Terrier query language.
+// Terrier has no nested Boolean operators, so clauses are flattened into required (+), optional, and prohibited (-)
+// terms. Queries that cannot be flattened without changing their meaning (e.g. an AND within an OR) are an error.
+func terrierQuery(query cqr.CommonQueryRepresentation) (string, error) {
+	var terms []string
+	// compile adds the terms of q with prefix; top is true for the outermost clause, where any operator can be used.
+	var compile func(q cqr.CommonQueryRepresentation, prefix string, top bool) error
+	compile = func(q cqr.CommonQueryRepresentation, prefix string, top bool) error {
+		switch x := q.(type) {
+		case cqr.Keyword:
+			s := x.QueryString
+			if strings.Contains(s, " ") {
+				s = fmt.Sprintf(`"%s"`, s)
+			}
+			terms = append(terms, prefix+s)
+		case cqr.BooleanQuery:
+			if len(x.Children) == 1 {
+				return compile(x.Children[0], prefix, top)
+			}
+			op := strings.ToLower(x.Operator)
+			for i, child := range x.Children {
+				var err error
+				switch {
+				case op == cqr.AND && (top || prefix == "+"):
+					err = compile(child, "+", false)
+				case op == cqr.OR && (top || prefix != "+"):
+					err = compile(child, prefix, false)
+				case op == cqr.NOT && (top || prefix == "+") && i == 0:
+					err = compile(child, prefix, top)
+				case op == cqr.NOT && (top || prefix == "+"):
+					err = compile(child, "-", false)
+				default:
+					return fmt.Errorf("the terrier source cannot express this nested %s, as the terrier query language has no nested Boolean operators", strings.ToUpper(x.Operator))
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := compile(query, "", true)
+	return strings.Join(terms, " "), err
+}
+
+// NewTerrierRESTStatisticsSource creates a statistics source that uses a Terrier REST bridge.
+func NewTerrierRESTStatisticsSource(config map[string]interface{}) (TerrierRESTStatisticsSource, error) {
+	t := TerrierRESTStatisticsSource{
+		field:  "text",
+		params: map[string]float64{"k": 10, "lambda": 0.5},
+		client: http.DefaultClient,
+	}
+
+	var options TerrierOptions
+	err := decodeOptions("terrier", config, &options)
+	if err != nil {
+		return t, err
+	}
+
+	if len(options.URL) == 0 {
+		return t, fmt.Errorf("the url of a terrier bridge must be specified to use terrier on this platform")
+	}
+	t.url = options.URL
+	t.properties = options.Properties
+
+	if len(options.Field) > 0 {
+		t.field = options.Field
+	}
+
+	if options.Params != nil {
+		t.params = options.Params
+	}
+
+	// The bridge always retrieves 1000 documents for the run "run" unless otherwise specified.
+	search := options.Search
+	if search == nil {
+		search = &SearchOptions{}
+	}
+	t.options = search.searchOptions()
+
+	return t, nil
+}
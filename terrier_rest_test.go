@@ -0,0 +1,137 @@
+package boogie
+
+import (
+	"fmt"
+	"github.com/hscells/cqr"
+	"github.com/hscells/groove/pipeline"
+	"github.com/hscells/groove/stats"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTerrierRESTStatisticsSource(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		if r.Method != http.MethodGet || r.URL.Query().Get("properties") != "terrier.properties" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/search":
+			if q.Get("query") == "fail" {
+				http.Error(w, "no index", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(w, "0 Q0 10 1 2.5 %[1]s\n0 Q0 20 2 1.5 %[1]s\n", q.Get("run_name"))
+		case "/term":
+			fmt.Fprintf(w, `{"df": 4, "ttf": 9}`)
+		case "/collection":
+			fmt.Fprintf(w, `{"documents": 100, "terms": 2500}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ss, err := NewTerrierRESTStatisticsSource(map[string]interface{}{
+		"url":        server.URL + "/",
+		"properties": "terrier.properties",
+		"field":      "title",
+		"search":     map[string]interface{}{"size": 50, "run_name": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := ss.SearchOptions(); o.Size != 50 || o.RunName != "test" {
+		t.Errorf("search options = %+v", o)
+	}
+
+	query := cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{
+		cqr.NewKeyword("heart attack", "title"),
+		cqr.NewKeyword("aspirin", "title"),
+	})
+	results, err := ss.Execute(pipeline.Query{Topic: "7", Query: query}, ss.SearchOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].DocId != "10" || results[1].DocId != "20" || results[0].Score != 2.5 {
+		t.Errorf("results = %v", results)
+	}
+	for _, r := range results {
+		if r.Topic != "7" || r.RunName != "test" {
+			t.Errorf("result %+v should have topic 7 and run test", *r)
+		}
+	}
+	if want := "/search?properties=terrier.properties&query=%2B%22heart+attack%22+%2Baspirin&run_name=test&size=50"; requests[0] != want {
+		t.Errorf("search request = %s, want %s", requests[0], want)
+	}
+
+	n, err := ss.RetrievalSize(query)
+	if err != nil || n != 2 {
+		t.Errorf("retrieval size = %v, %v, want 2", n, err)
+	}
+	if !strings.Contains(requests[1], "size=2147483647") {
+		t.Errorf("retrieval size request = %s, want the size 2147483647", requests[1])
+	}
+
+	for _, test := range []struct {
+		name string
+		f    func() (float64, error)
+		want float64
+	}{
+		{"df", func() (float64, error) { return ss.DocumentFrequency("heart", "title") }, 4},
+		{"ttf", func() (float64, error) { return ss.TotalTermFrequency("heart", "title") }, 9},
+		{"idf", func() (float64, error) { return ss.InverseDocumentFrequency("heart", "title") }, math.Log(100.0 / 4)},
+		{"vocabulary", func() (float64, error) { return ss.VocabularySize("title") }, 2500},
+		{"collection", ss.CollectionSize, 100},
+	} {
+		got, err := test.f()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if got != test.want {
+			t.Errorf("%s = %v, want %v", test.name, got, test.want)
+		}
+	}
+	if want := "/term?field=title&properties=terrier.properties&term=heart"; requests[2] != want {
+		t.Errorf("term request = %s, want %s", requests[2], want)
+	}
+	if want := "/collection?field=title&properties=terrier.properties"; requests[len(requests)-1] != want {
+		t.Errorf("collection request = %s, want %s", requests[len(requests)-1], want)
+	}
+
+	_, err = ss.Execute(pipeline.Query{Query: cqr.NewKeyword("fail", "title")}, stats.SearchOptions{Size: 1})
+	if err == nil || !strings.Contains(err.Error(), "no index") {
+		t.Errorf("expected the error of the bridge, got %v", err)
+	}
+	_, err = ss.TermVector("10")
+	if err == nil {
+		t.Error("expected term vectors to be unsupported")
+	}
+}
+
+func TestTerrierQuery(t *testing.T) {
+	for _, test := range []struct {
+		query cqr.CommonQueryRepresentation
+		want  string
+		err   bool
+	}{
+		{cqr.NewKeyword("heart", "text"), "heart", false},
+		{cqr.NewBooleanQuery(cqr.NOT, []cqr.CommonQueryRepresentation{cqr.NewKeyword("heart", "text"), cqr.NewKeyword("lung", "text")}), "heart -lung", false},
+		{cqr.NewBooleanQuery(cqr.OR, []cqr.CommonQueryRepresentation{
+			cqr.NewKeyword("heart", "text"),
+			cqr.NewBooleanQuery(cqr.AND, []cqr.CommonQueryRepresentation{cqr.NewKeyword("lung", "text"), cqr.NewKeyword("liver", "text")}),
+		}), "", true},
+	} {
+		got, err := terrierQuery(test.query)
+		if (err != nil) != test.err {
+			t.Errorf("%v: error = %v", test.query, err)
+		} else if !test.err && got != test.want {
+			t.Errorf("%v = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
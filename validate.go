@@ -0,0 +1,466 @@
+package boogie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError is a problem found when validating a pipeline, with the location it was found at. Lines and columns
+// start at 1, and columns are counted in bytes (as they are in the positions of Go errors).
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", e.File, e.Line, e.Column, e.Path, e.Message)
+}
+
+// ValidationErrors are all of the problems found when validating a pipeline.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Validate checks the types of the options of each component in a pipeline.
+// Since unknown keys are discarded when a pipeline is decoded, use ValidateFile to also check for unknown keys.
+func Validate(p Pipeline) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ValidateJSON("pipeline", b)
+}
+
+// ValidateFile templates a pipeline file and validates the result.
+// Line numbers and columns refer to the template (see ValidateTemplate).
+func ValidateFile(filename string, r io.Reader, args ...string) error {
+	return ValidateTemplate(filename, r, TemplateContext{Args: args})
+}
+
+// ValidateTemplate templates a pipeline file using the positional and named arguments of ctx, and validates the
+// result.
+// Line numbers and columns refer to the template; a problem in a value substituted from a template (including the
+// contents of a template file) is reported at its reference (e.g. %name). Pipelines which extend or include other
+// files, or which are not JSON, are validated after they have been resolved, and line numbers refer to the resolved
+// pipeline (as output by `btmpl --resolved`).
+func ValidateTemplate(filename string, r io.Reader, ctx TemplateContext) error {
+	b, sources, err := resolvePipeline(filename, r, ctx)
+	if err != nil {
+		return err
+	}
+	if sources == nil {
+		return ValidateJSON(filename+" (resolved)", b)
+	}
+	err = ValidateJSON(filename, b)
+	if errs, ok := err.(ValidationErrors); ok {
+		for i := range errs {
+			errs[i].Line, errs[i].Column = sources.position(errs[i].Line, errs[i].Column)
+		}
+	}
+	return err
+}
+
+// ValidateJSON checks a JSON pipeline for unknown keys and values of the wrong type, including the options of each
+// component. All of the problems that are found are returned as ValidationErrors.
+func ValidateJSON(filename string, b []byte) error {
+	p := &jsonParser{data: b, line: 1, col: 1}
+	root, err := p.parse()
+	if err != nil {
+		return ValidationErrors{{File: filename, Line: p.line, Column: p.col, Path: "$", Message: err.Error()}}
+	}
+
+	v := validator{file: filename}
+	v.validate(root, nil, pipelineSchema(), "$")
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// schema describes the expected shape of a value in a pipeline.
+type schema struct {
+	kind   string // One of: any, string, number, bool, object, array, map.
+	fields map[string]*schema
+	items  *schema
+	// dynamic resolves the schema of a value using the object containing it (e.g. options depend on the source).
+	dynamic func(parent *jsonNode) *schema
+}
+
+var (
+	anything = &schema{kind: "any"}
+	str      = &schema{kind: "string"}
+	num      = &schema{kind: "number"}
+	boolean  = &schema{kind: "bool"}
+)
+
+func obj(fields map[string]*schema) *schema { return &schema{kind: "object", fields: fields} }
+func arr(items *schema) *schema             { return &schema{kind: "array", items: items} }
+func mapOf(items *schema) *schema           { return &schema{kind: "map", items: items} }
+
+// dynamicOptions resolves the schema of options from a field of the containing object.
+// Components that are not built-in (i.e. registered by other means) may have any options.
+func dynamicOptions(key string, schemas map[string]*schema) *schema {
+	return &schema{dynamic: func(parent *jsonNode) *schema {
+		if parent != nil {
+			if n, ok := parent.fields[key]; ok && n.kind == "string" {
+				if s, ok := schemas[n.str]; ok {
+					return s
+				}
+			}
+		}
+		return mapOf(anything)
+	}}
+}
+
+// statisticOptionSchemas are the options accepted by each built-in statistic source.
+var statisticOptionSchemas = map[string]*schema{
+	"elasticsearch":   schemaOf(reflect.TypeOf(ElasticsearchOptions{})),
+	"entrez":          schemaOf(reflect.TypeOf(EntrezOptions{})),
+	"terrier":         schemaOf(reflect.TypeOf(TerrierOptions{})),
+	"local":           schemaOf(reflect.TypeOf(LocalOptions{})),
+	"pubmed_baseline": schemaOf(reflect.TypeOf(PubMedBaselineOptions{})),
+}
+
+// queryOptionSchemas are the options accepted by each built-in query source.
+var queryOptionSchemas = map[string]*schema{
+	"medline": schemaOf(reflect.TypeOf(TransmuteQueryOptions{})),
+	"pubmed":  schemaOf(reflect.TypeOf(TransmuteQueryOptions{})),
+	"cqr":     schemaOf(reflect.TypeOf(TransmuteQueryOptions{})),
+	"keyword": schemaOf(reflect.TypeOf(KeywordQueryOptions{})),
+}
+
+// cacheOptionSchemas are the options accepted by each cache.
+var cacheOptionSchemas = map[string]*schema{
+	"memory": schemaOf(reflect.TypeOf(CacheOptions{})),
+	"file":   schemaOf(reflect.TypeOf(FileCacheOptions{})),
+}
+
+// pipelineSchema creates the schema of the whole DSL from the Pipeline struct, and the schemas of component options.
+func pipelineSchema() *schema {
+	s := schemaOf(reflect.TypeOf(Pipeline{}))
+	statistic := s.fields["statistic"]
+	statistic.fields["options"] = dynamicOptions("source", statisticOptionSchemas)
+	statistic.fields["sources"] = arr(obj(map[string]*schema{
+		"source":  str,
+		"name":    str,
+		"output":  str,
+		"options": dynamicOptions("source", statisticOptionSchemas),
+	}))
+	s.fields["query"].fields["options"] = dynamicOptions("format", queryOptionSchemas)
+	s.fields["cache"].items.fields["options"] = dynamicOptions("type", cacheOptionSchemas)
+	s.fields["scorer_options"] = schemaOf(reflect.TypeOf(ScorerOptions{}))
+	s.fields["learning"].fields["generate"] = schemaOf(reflect.TypeOf(GenerateOptions{}))
+	return s
+}
+
+// schemaOf creates a schema from a type using its json struct tags.
+func schemaOf(t reflect.Type) *schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return str
+	case reflect.Bool:
+		return boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return num
+	case reflect.Slice, reflect.Array:
+		return arr(schemaOf(t.Elem()))
+	case reflect.Map:
+		return mapOf(schemaOf(t.Elem()))
+	case reflect.Struct:
+		s := obj(make(map[string]*schema))
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if len(f.PkgPath) > 0 {
+				continue
+			}
+			name := f.Name
+			if tag, ok := f.Tag.Lookup("json"); ok {
+				tag = strings.Split(tag, ",")[0]
+				if tag == "-" {
+					continue
+				}
+				if len(tag) > 0 {
+					name = tag
+				}
+			}
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				for k, v := range schemaOf(f.Type).fields {
+					s.fields[k] = v
+				}
+				continue
+			}
+			s.fields[name] = schemaOf(f.Type)
+		}
+		return s
+	}
+	return anything
+}
+
+type validator struct {
+	file string
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(n *jsonNode, path, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{
+		File:    v.file,
+		Line:    n.line,
+		Column:  n.col,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(n, parent *jsonNode, s *schema, path string) {
+	if s.dynamic != nil {
+		s = s.dynamic(parent)
+	}
+	// Values can always be omitted with null.
+	if s.kind == "any" || n.kind == "null" {
+		return
+	}
+
+	kind := s.kind
+	if kind == "map" {
+		kind = "object"
+	}
+	if n.kind != kind {
+		v.errorf(n, path, "expected %s, got %s", kind, n.kind)
+		return
+	}
+
+	switch s.kind {
+	case "object":
+		for _, key := range n.keys {
+			child := n.fields[key]
+			p := path + "." + key
+			if fs, ok := s.fields[key]; ok {
+				v.validate(child, n, fs, p)
+			} else {
+				known := make([]string, 0, len(s.fields))
+				for k := range s.fields {
+					known = append(known, k)
+				}
+				sort.Strings(known)
+				v.errorf(n.keyNodes[key], p, "unknown key %q (expected one of: %s)", key, strings.Join(known, ", "))
+			}
+		}
+	case "map":
+		for _, key := range n.keys {
+			v.validate(n.fields[key], n, s.items, path+"."+key)
+		}
+	case "array":
+		for i, item := range n.items {
+			v.validate(item, n, s.items, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// jsonNode is a parsed JSON value that retains where it is located in the source.
+type jsonNode struct {
+	kind      string // One of: object, array, string, number, bool, null.
+	line, col int
+	// offset and end are the byte offsets of the value in the source.
+	offset, end int
+	keys        []string
+	fields      map[string]*jsonNode
+	keyNodes    map[string]*jsonNode
+	items       []*jsonNode
+	str         string
+}
+
+// jsonParser is a small JSON parser which tracks the line and column of each value.
+// encoding/json does not expose the location of values, which is needed to report errors precisely.
+type jsonParser struct {
+	data      []byte
+	pos       int
+	line, col int
+}
+
+func (p *jsonParser) parse() (*jsonNode, error) {
+	n, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.space()
+	if p.pos < len(p.data) {
+		return nil, fmt.Errorf("unexpected %q after end of pipeline", p.data[p.pos])
+	}
+	return n, nil
+}
+
+func (p *jsonParser) advance(n int) {
+	for i := 0; i < n && p.pos < len(p.data); i++ {
+		if p.data[p.pos] == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+		p.pos++
+	}
+}
+
+func (p *jsonParser) space() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.advance(1)
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) value() (*jsonNode, error) {
+	p.space()
+	if p.pos >= len(p.data) {
+		return nil, fmt.Errorf("unexpected end of pipeline")
+	}
+	n := &jsonNode{line: p.line, col: p.col, offset: p.pos}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		n.kind = "object"
+		n.fields = make(map[string]*jsonNode)
+		n.keyNodes = make(map[string]*jsonNode)
+		p.advance(1)
+		p.space()
+		if p.pos < len(p.data) && p.data[p.pos] == '}' {
+			p.advance(1)
+			return n, nil
+		}
+		for {
+			p.space()
+			key, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			key.end = p.pos
+			if key.kind != "string" {
+				return nil, fmt.Errorf("expected string key, got %s", key.kind)
+			}
+			p.space()
+			if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+				return nil, fmt.Errorf("expected ':' after key %q", key.str)
+			}
+			p.advance(1)
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			v.end = p.pos
+			if _, ok := n.fields[key.str]; !ok {
+				n.keys = append(n.keys, key.str)
+			}
+			n.fields[key.str] = v
+			n.keyNodes[key.str] = key
+			if done, err := p.next('}'); err != nil || done {
+				return n, err
+			}
+		}
+	case c == '[':
+		n.kind = "array"
+		p.advance(1)
+		p.space()
+		if p.pos < len(p.data) && p.data[p.pos] == ']' {
+			p.advance(1)
+			return n, nil
+		}
+		for {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			v.end = p.pos
+			n.items = append(n.items, v)
+			if done, err := p.next(']'); err != nil || done {
+				return n, err
+			}
+		}
+	case c == '"':
+		n.kind = "string"
+		start := p.pos
+		p.advance(1)
+		for p.pos < len(p.data) && p.data[p.pos] != '"' {
+			if p.data[p.pos] == '\\' {
+				p.advance(1)
+			}
+			p.advance(1)
+		}
+		if p.pos >= len(p.data) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		p.advance(1)
+		s, err := strconv.Unquote(string(p.data[start:p.pos]))
+		if err != nil {
+			// strconv does not understand all JSON escapes (e.g. \/), so fall back to encoding/json.
+			err = json.Unmarshal(p.data[start:p.pos], &s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", p.data[start:p.pos])
+			}
+		}
+		n.str = s
+	case c == '-' || (c >= '0' && c <= '9'):
+		n.kind = "number"
+		start := p.pos
+		for p.pos < len(p.data) && bytes.IndexByte([]byte("+-0123456789.eE"), p.data[p.pos]) >= 0 {
+			p.advance(1)
+		}
+		n.str = string(p.data[start:p.pos])
+		if _, err := strconv.ParseFloat(n.str, 64); err != nil {
+			return nil, fmt.Errorf("invalid number %s", n.str)
+		}
+	case bytes.HasPrefix(p.data[p.pos:], []byte("true")):
+		n.kind = "bool"
+		n.str = "true"
+		p.advance(4)
+	case bytes.HasPrefix(p.data[p.pos:], []byte("false")):
+		n.kind = "bool"
+		n.str = "false"
+		p.advance(5)
+	case bytes.HasPrefix(p.data[p.pos:], []byte("null")):
+		n.kind = "null"
+		p.advance(4)
+	default:
+		r, _ := utf8.DecodeRune(p.data[p.pos:])
+		return nil, fmt.Errorf("unexpected %q", r)
+	}
+	return n, nil
+}
+
+// next consumes the separator between items of an object or array, reporting whether the closing character was found.
+func (p *jsonParser) next(closing byte) (bool, error) {
+	p.space()
+	if p.pos >= len(p.data) {
+		return false, fmt.Errorf("unexpected end of pipeline")
+	}
+	switch p.data[p.pos] {
+	case ',':
+		p.advance(1)
+		return false, nil
+	case closing:
+		p.advance(1)
+		return true, nil
+	}
+	return false, fmt.Errorf("expected ',' or '%c', got %q", closing, p.data[p.pos])
+}
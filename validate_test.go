@@ -0,0 +1,88 @@
+package boogie
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	pipeline := `{
+  "query": {"format": "medline", "path": "queries/"},
+  "evaluations": [],
+  "statistic": {
+    "source": "local",
+    "options": {"collection": "c.txt", "search": {"size": "10"}}
+  },
+  "measurements": "retrieval_size",
+  "cache": [{"type": "file", "options": {"path": 1}}]
+}
+`
+	err := ValidateJSON("pipeline.json", []byte(pipeline))
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	type location struct {
+		line, col int
+		path      string
+	}
+	var got []location
+	for _, e := range errs {
+		if e.File != "pipeline.json" {
+			t.Errorf("%v: file = %s", e, e.File)
+		}
+		got = append(got, location{e.Line, e.Column, e.Path})
+	}
+	want := []location{
+		{3, 3, "$.evaluations"},
+		{6, 59, "$.statistic.options.search.size"},
+		{8, 19, "$.measurements"},
+		{9, 50, "$.cache[0].options.path"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors at %v, want %v:\n%v", got, want, err)
+	}
+	if !strings.HasPrefix(errs[0].Message, `unknown key "evaluations" (expected one of: `) {
+		t.Errorf("message = %s", errs[0].Message)
+	}
+	if errs[2].Message != "expected array, got string" {
+		t.Errorf("message = %s", errs[2].Message)
+	}
+}
+
+func TestValidateJSONSyntax(t *testing.T) {
+	for _, test := range []struct {
+		pipeline string
+		want     string
+	}{
+		{"{\n  \"query\": ,\n}", `p.json:2:12: $: unexpected ','`},
+		{"{\n  \"measurements\": [\"a\"\n", `p.json:3:1: $: unexpected end of pipeline`},
+		// Columns are counted in bytes.
+		{"{\"measurements\": [\"é\", ü]}", `p.json:1:25: $: unexpected 'ü'`},
+		{"{}\n{}", `p.json:2:1: $: unexpected '{' after end of pipeline`},
+	} {
+		err := ValidateJSON("p.json", []byte(test.pipeline))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: error = %v, want %s", test.pipeline, err, test.want)
+		}
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	// The error is reported at the reference to the size, although the path substituted before it is longer than %path.
+	template := `default size "100"
+default path queries/
+{
+  "query": {"format": "medline", "path": "%path"}, "statistic": {"source": "local", "options": {"search": {"size": %size}}}
+}
+`
+	err := ValidateTemplate("p.tmpl", strings.NewReader(template), TemplateContext{})
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("expected one validation error, got %v", err)
+	}
+	if e := errs[0]; e.Line != 4 || e.Column != 116 || e.Path != "$.statistic.options.search.size" {
+		t.Errorf("error = %v, want p.tmpl:4:116 at $.statistic.options.search.size", e)
+	}
+}